@@ -15,34 +15,22 @@
 package collector
 
 import (
-	"fmt"
+	"context"
 	"sync"
 	"time"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
-	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
 const (
-	prefix          = "spectrum_collector_"
 	defaultEnabled  = true
 	defaultDisabled = false
 )
 
 var (
-	mySC                       *svcCollector = nil
-	once                       sync.Once
-	scrapeDurationDesc         *prometheus.Desc
-	authTokenRenewIntervalDesc *prometheus.Desc
-	authTokenRenewSuccessDesc  *prometheus.Desc
-	authTokenRenewFailureDesc  *prometheus.Desc
-	hosts                      []utils.Target
-	collectors                 map[string]Collector
-	sClients                   map[string]*utils.SpectrumClient
-	factories                  = make(map[string]func() (Collector, error))
-	collectorState             = make(map[string]*bool)
-	logger                     = *utils.SpectrumLogger()
+	collectorSet = utils.NewCollectorSet("metrics")
+	logger       = *utils.SpectrumLogger()
 )
 
 type SVCCollector interface {
@@ -50,131 +38,64 @@ type SVCCollector interface {
 	Collect(ch chan<- prometheus.Metric)
 }
 
-// SVCollector implements the prometheus.Collector interface
-type svcCollector struct{}
+// Collector is the interface a collector has to implement.
+type Collector = utils.Collector
 
 func registerCollector(collector string, isDefaultEnabled bool, factory func() (Collector, error)) {
-	var helpDefaultState string
-	if isDefaultEnabled {
-		helpDefaultState = "enabled"
-	} else {
-		helpDefaultState = "disabled"
-	}
-
-	flagName := fmt.Sprintf("collector.%s", collector)
-	flagHelp := fmt.Sprintf("enable the %s collector (default: %s)", collector, helpDefaultState)
-	defaultValue := fmt.Sprintf("%v", isDefaultEnabled)
+	collectorSet.Register(collector, isDefaultEnabled, factory)
+}
 
-	flag := kingpin.Flag(flagName, flagHelp).Default(defaultValue).Bool()
-	collectorState[collector] = flag
+// NewSVCCollector creates a new Spectrum Virtualize Collector for the given targets.
+// The collectors and metric descriptors are set up once, while the targets are
+// selected per request. Outstanding REST calls are canceled when ctx is done.
+func NewSVCCollector(ctx context.Context, targets []utils.Target, tokenCaches map[string]*utils.AuthToken, tokenMutexes map[string]*sync.Mutex, colCounters map[string]*utils.Counter, transports map[string]*utils.Transport) (SVCCollector, error) {
+	c, err := collectorSet.NewSVCCollector(ctx, targets, tokenCaches, tokenMutexes, colCounters, transports)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
-	factories[collector] = factory
+// StartPolling collects the targets with the enabled collectors in the background every interval.
+// A running background collection is stopped first.
+func StartPolling(targets []utils.Target, interval time.Duration, tokenCaches map[string]*utils.AuthToken, tokenMutexes map[string]*sync.Mutex, colCounters map[string]*utils.Counter, transports map[string]*utils.Transport) error {
+	return collectorSet.StartPolling(targets, interval, tokenCaches, tokenMutexes, colCounters, transports)
 }
 
-// NewSVCCollector creates a new Spectrum Virtualize Collector.
-func NewSVCCollector(targets []utils.Target, tokenCaches map[string]*utils.AuthToken, tokenMutexes map[string]*sync.Mutex, colCounters map[string]*utils.Counter) (SVCCollector, error) {
-	var (
-		err       error = nil
-		collector Collector
-	)
-	once.Do(func() {
-		labelnames := []string{"resource"}
-		if len(utils.ExtraLabelNames) > 0 {
-			labelnames = append(labelnames, utils.ExtraLabelNames...)
-		}
-		// metric name, help information, Array of defined label names, defined labels
-		scrapeDurationDesc = prometheus.NewDesc(prefix+"scrape_duration_seconds", "Duration of a collector scraping for one host", labelnames, nil)
-		authTokenRenewIntervalDesc = prometheus.NewDesc(prefix+"authtoken_renew_interval_seconds", "Interval of renewing auth token", labelnames, nil)
-		authTokenRenewSuccessDesc = prometheus.NewDesc(prefix+"authtoken_renew_success_total", "Cumulative count of success verification of renewed auth token", labelnames, nil)
-		authTokenRenewFailureDesc = prometheus.NewDesc(prefix+"authtoken_renew_failure_total", "Cumulative count of failed verification of renewed auth token", labelnames, nil)
-
-		hosts = targets
-		collectors = make(map[string]Collector)
-		logger.Infof("enabled metrics collectors:")
-		for key, enabled := range collectorState {
-			if *enabled {
-				collector, err = factories[key]()
-				if err != nil {
-					logger.Errorln("failed to load metrics collector: ", key)
-					return
-				}
-				collectors[key] = collector
-				logger.Infof(" - %s", key)
-			}
-		}
-		sClients = make(map[string]*utils.SpectrumClient)
-		for _, t := range targets {
-			sClients[t.IpAddress] = &utils.SpectrumClient{
-				UserName:       t.Userid,
-				Password:       t.Password,
-				IpAddress:      t.IpAddress,
-				AuthTokenCache: tokenCaches[t.IpAddress],
-				AuthTokenMutex: tokenMutexes[t.IpAddress],
-				ColCounter:     colCounters[t.IpAddress],
-			}
-		}
-		mySC = &svcCollector{}
-	})
-	return *mySC, err
+// StopPolling stops the background collection. Afterwards the targets are scraped on every request again.
+func StopPolling() {
+	collectorSet.StopPolling()
 }
 
-// Describe implements the Prometheus.Collector interface.
-func (c svcCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- scrapeDurationDesc
-	ch <- authTokenRenewSuccessDesc
-	ch <- authTokenRenewFailureDesc
-	ch <- authTokenRenewIntervalDesc
-	for _, col := range collectors {
-		col.Describe(ch)
+// NewModuleCollector creates a new Spectrum Virtualize Collector for the given targets which runs
+// only the named collectors, regardless of the --collector.[name] flags. Names which are not
+// registered in this package are ignored. The scrape duration and auth token metrics are only
+// exposed when selfMetrics is true. Outstanding REST calls are canceled when ctx is done.
+func NewModuleCollector(ctx context.Context, targets []utils.Target, names []string, selfMetrics bool, tokenCaches map[string]*utils.AuthToken, tokenMutexes map[string]*sync.Mutex, colCounters map[string]*utils.Counter, transports map[string]*utils.Transport) (SVCCollector, error) {
+	c, err := collectorSet.NewModuleCollector(ctx, targets, names, selfMetrics, tokenCaches, tokenMutexes, colCounters, transports)
+	if err != nil {
+		return nil, err
 	}
+	return c, nil
 }
 
-// Collect implements the Prometheus.Collector interface.
-func (c svcCollector) Collect(ch chan<- prometheus.Metric) {
-	wg := &sync.WaitGroup{}
-	wg.Add(len(hosts))
-	for _, h := range hosts {
-		go c.collectForHost(h, ch, wg)
-	}
-	wg.Wait()
+// SetupCollectors creates the metric descriptors and the collectors. They are created again when the
+// extra labels have changed, which requires holding utils.ExtraLabelsMutex for writing.
+func SetupCollectors() error {
+	return collectorSet.Setup()
 }
 
-func (c *svcCollector) collectForHost(host utils.Target, ch chan<- prometheus.Metric, wg *sync.WaitGroup) {
-	defer wg.Done()
-	start := time.Now()
-	success := 0
-	var counter utils.Counter
-	spectrumClient := sClients[host.IpAddress]
-	labelvalues := []string{spectrumClient.Hostname}
-	if len(utils.ExtraLabelValues) > 0 {
-		labelvalues = append(labelvalues, utils.ExtraLabelValues...)
-	}
-	defer func() {
-		ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, time.Since(start).Seconds(), labelvalues...)
-		ch <- prometheus.MustNewConstMetric(authTokenRenewSuccessDesc, prometheus.CounterValue, float64(counter.AuthTokenRenewSuccessCount), labelvalues...)
-		ch <- prometheus.MustNewConstMetric(authTokenRenewFailureDesc, prometheus.CounterValue, float64(counter.AuthTokenRenewFailureCount), labelvalues...)
-		ch <- prometheus.MustNewConstMetric(authTokenRenewIntervalDesc, prometheus.GaugeValue, float64(counter.AuthTokenRenewIntervalSeconds), labelvalues...)
-	}()
-
-	counter, success = sClients[host.IpAddress].RenewAuthToken(true)
-
-	if success == 0 {
-		logger.Errorln("no valid auth token, skip executing metrics collectors")
-	} else {
-		for k, col := range collectors {
-			err := col.Collect(*spectrumClient, ch)
-			if err != nil && err.Error() != "EOF" {
-				logger.Errorln(k + ": " + err.Error())
-			}
-		}
-	}
+// ConfigureCollectors sets the refresh intervals and timeouts of the collectors.
+// Names which are not registered in this package are ignored.
+func ConfigureCollectors(configs map[string]utils.CollectorConfig) {
+	collectorSet.Configure(configs)
 }
 
-// Collector is the interface a collector has to implement.
-type Collector interface {
-	// Describe metrics
-	Describe(ch chan<- *prometheus.Desc)
+func collectorConfig(name string) utils.CollectorConfig {
+	return collectorSet.Config(name)
+}
 
-	// Collect metrics
-	Collect(client utils.SpectrumClient, ch chan<- prometheus.Metric) error
+// IsRegistered reports whether a collector with the given name is registered in this package.
+func IsRegistered(name string) bool {
+	return collectorSet.IsRegistered(name)
 }
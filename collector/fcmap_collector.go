@@ -0,0 +1,210 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IBM/spectrum-virtualize-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	prefix_fcmap        = "spectrum_fcmap_"
+	prefix_fcconsistgrp = "spectrum_fcconsistgrp_"
+)
+
+var (
+	fcmap_status         *prometheus.Desc
+	fcmap_progress       *prometheus.Desc
+	fcmap_copy_rate      *prometheus.Desc
+	fcmap_clean_progress *prometheus.Desc
+	fcmap_clean_rate     *prometheus.Desc
+	fcconsistgrp_status  *prometheus.Desc
+)
+
+func init() {
+	registerCollector("lsfcmap", defaultDisabled, NewFCMapCollector)
+}
+
+// fcMapCollector collects FlashCopy mapping and consistency group metrics
+type fcMapCollector struct {
+}
+
+func NewFCMapCollector() (Collector, error) {
+	labelnames_fcmap := []string{"resource", "fcmap_id", "fcmap_name", "source_volume_name", "target_volume_name", "group_name"}
+	labelnames_fcconsistgrp := []string{"resource", "group_id", "group_name"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames_fcmap = append(labelnames_fcmap, utils.ExtraLabelNames...)
+		labelnames_fcconsistgrp = append(labelnames_fcconsistgrp, utils.ExtraLabelNames...)
+	}
+	fcmap_status = prometheus.NewDesc(prefix_fcmap+"status", "The state of the FlashCopy mapping. -1-unknown; 0-idle_or_copied; 1-preparing; 2-prepared; 3-copying; 4-stopping; 5-stopped; 6-suspended.", labelnames_fcmap, nil)
+	fcmap_progress = prometheus.NewDesc(prefix_fcmap+"progress", "The percentage of the background copy of the FlashCopy mapping that is complete.", labelnames_fcmap, nil)
+	fcmap_copy_rate = prometheus.NewDesc(prefix_fcmap+"copy_rate", "The background copy rate of the FlashCopy mapping, 0-150.", labelnames_fcmap, nil)
+	fcmap_clean_progress = prometheus.NewDesc(prefix_fcmap+"clean_progress", "The percentage of the cleaning of the FlashCopy mapping that is complete.", labelnames_fcmap, nil)
+	fcmap_clean_rate = prometheus.NewDesc(prefix_fcmap+"clean_rate", "The cleaning rate of the FlashCopy mapping, 0-150.", labelnames_fcmap, nil)
+	fcconsistgrp_status = prometheus.NewDesc(prefix_fcconsistgrp+"status", "The state of the FlashCopy consistency group. -1-unknown; 0-idle_or_copied; 1-preparing; 2-prepared; 3-copying; 4-stopping; 5-stopped; 6-suspended; 7-empty.", labelnames_fcconsistgrp, nil)
+	return &fcMapCollector{}, nil
+}
+
+// Describe describes the metrics
+func (*fcMapCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	ch <- fcmap_status
+	ch <- fcmap_progress
+	ch <- fcmap_copy_rate
+	ch <- fcmap_clean_progress
+	ch <- fcmap_clean_rate
+	ch <- fcconsistgrp_status
+
+}
+
+// fcStatus returns the value of the state of a FlashCopy mapping or consistency group.
+func fcStatus(status string) int {
+	switch status {
+	case "idle_or_copied":
+		return 0
+	case "preparing":
+		return 1
+	case "prepared":
+		return 2
+	case "copying":
+		return 3
+	case "stopping":
+		return 4
+	case "stopped":
+		return 5
+	case "suspended":
+		return 6
+	case "empty":
+		return 7
+	}
+	return -1
+}
+
+// Collect collects metrics from Spectrum Virtualize Restful API
+func (c *fcMapCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+	logger.Debugln("entering fcmap collector ...")
+	fcMapResp, err := sClient.CallSpectrumAPI(ctx, "lsfcmap", true)
+	if err != nil {
+		logger.Errorf("Executing lsfcmap cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lsfcmap: ", fcMapResp)
+	// This is a sample output of lsfcmap
+	// [
+	//     {
+	//         "id": "0",
+	//         "name": "fcmap0",
+	//         "source_vdisk_id": "0",
+	//         "source_vdisk_name": "vdisk0",
+	//         "target_vdisk_id": "1",
+	//         "target_vdisk_name": "vdisk1",
+	//         "group_id": "0",
+	//         "group_name": "fccstgrp0",
+	//         "status": "copying",
+	//         "progress": "42",
+	//         "copy_rate": "50",
+	//         "clean_progress": "100",
+	//         "incremental": "off",
+	//         "partner_FC_id": "",
+	//         "partner_FC_name": "",
+	//         "restoring": "no",
+	//         "start_time": "240105103000",
+	//         "rc_controlled": "no"
+	//     }
+	// ]
+	if !gjson.Valid(fcMapResp) {
+		return fmt.Errorf("invalid json for lsfcmap: %v", fcMapResp)
+	}
+	// the clean rate is only in the detailed view of a mapping, which costs a REST call per mapping
+	cleanRate := collectorConfig("lsfcmap").CleanRate
+	for _, fcMap := range gjson.Parse(fcMapResp).Array() {
+		fcmap_id := fcMap.Get("id").String()
+		labelvalues := []string{sClient.Hostname, fcmap_id, fcMap.Get("name").String(), fcMap.Get("source_vdisk_name").String(), fcMap.Get("target_vdisk_name").String(), fcMap.Get("group_name").String()}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(fcmap_status, prometheus.GaugeValue, float64(fcStatus(fcMap.Get("status").String())), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(fcmap_progress, prometheus.GaugeValue, fcMap.Get("progress").Float(), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(fcmap_copy_rate, prometheus.GaugeValue, fcMap.Get("copy_rate").Float(), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(fcmap_clean_progress, prometheus.GaugeValue, fcMap.Get("clean_progress").Float(), labelvalues...)
+
+		if !cleanRate {
+			continue
+		}
+		fcMapDetailResp, err := sClient.CallSpectrumAPI(ctx, "lsfcmap/"+fcmap_id, true)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			// the metrics of the other mappings are still collected
+			logger.Errorf("Executing lsfcmap/%s cmd failed: %s", fcmap_id, err.Error())
+			continue
+		}
+		logger.Debugf("response of lsfcmap/%s: %s", fcmap_id, fcMapDetailResp)
+		// This is a sample output of lsfcmap/<id>
+		// {
+		//     "id": "0",
+		//     "name": "fcmap0",
+		//     ...
+		//     "status": "copying",
+		//     "progress": "42",
+		//     "copy_rate": "50",
+		//     "start_time": "240105103000",
+		//     "dependent_mappings": "0",
+		//     "autodelete": "off",
+		//     "clean_progress": "100",
+		//     "clean_rate": "50",
+		//     "incremental": "off",
+		//     ...
+		// }
+		if !gjson.Valid(fcMapDetailResp) {
+			logger.Errorf("invalid json for lsfcmap/%s: %v", fcmap_id, fcMapDetailResp)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(fcmap_clean_rate, prometheus.GaugeValue, gjson.Get(fcMapDetailResp, "clean_rate").Float(), labelvalues...)
+	}
+
+	fcConsistGrpResp, err := sClient.CallSpectrumAPI(ctx, "lsfcconsistgrp", true)
+	if err != nil {
+		logger.Errorf("Executing lsfcconsistgrp cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lsfcconsistgrp: ", fcConsistGrpResp)
+	// This is a sample output of lsfcconsistgrp
+	// [
+	//     {
+	//         "id": "0",
+	//         "name": "fccstgrp0",
+	//         "status": "copying",
+	//         "start_time": "240105103000"
+	//     }
+	// ]
+	if !gjson.Valid(fcConsistGrpResp) {
+		return fmt.Errorf("invalid json for lsfcconsistgrp: %v", fcConsistGrpResp)
+	}
+	for _, group := range gjson.Parse(fcConsistGrpResp).Array() {
+		labelvalues := []string{sClient.Hostname, group.Get("id").String(), group.Get("name").String()}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(fcconsistgrp_status, prometheus.GaugeValue, float64(fcStatus(group.Get("status").String())), labelvalues...)
+	}
+	logger.Debugln("exit fcmap collector")
+	return nil
+}
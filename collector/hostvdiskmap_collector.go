@@ -0,0 +1,236 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IBM/spectrum-virtualize-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	prefix_hostmap     = "spectrum_host_"
+	prefix_hostcluster = "spectrum_hostcluster_"
+)
+
+var (
+	hostVolumeMappingInfo     *prometheus.Desc
+	hostMappedVolumes         *prometheus.Desc
+	hostMappedCapacity        *prometheus.Desc
+	hostClusterHostCount      *prometheus.Desc
+	hostClusterMappedVolumes  *prometheus.Desc
+	hostClusterMappedCapacity *prometheus.Desc
+)
+
+func init() {
+	registerCollector("lshostvdiskmap", defaultDisabled, NewHostVdiskMapCollector)
+}
+
+// hostVdiskMapCollector collects the mappings of volumes to hosts and host clusters
+type hostVdiskMapCollector struct {
+}
+
+func NewHostVdiskMapCollector() (Collector, error) {
+	labelnames_mapping := []string{"resource", "host", "host_cluster", "volume_id", "volume", "scsi_id", "io_group", "mapping_type"}
+	labelnames_host := []string{"resource", "host", "host_cluster"}
+	labelnames_hostcluster := []string{"resource", "host_cluster_id", "host_cluster"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames_mapping = append(labelnames_mapping, utils.ExtraLabelNames...)
+		labelnames_host = append(labelnames_host, utils.ExtraLabelNames...)
+		labelnames_hostcluster = append(labelnames_hostcluster, utils.ExtraLabelNames...)
+	}
+	hostVolumeMappingInfo = prometheus.NewDesc(prefix_hostmap+"volume_mapping_info", "A mapping of a volume to a host, the value is always 1.", labelnames_mapping, nil)
+	hostMappedVolumes = prometheus.NewDesc(prefix_hostmap+"mapped_volumes", "The number of volumes mapped to the host.", labelnames_host, nil)
+	hostMappedCapacity = prometheus.NewDesc(prefix_hostmap+"mapped_capacity", "The total virtual capacity of the volumes mapped to the host.", labelnames_host, nil)
+	hostClusterHostCount = prometheus.NewDesc(prefix_hostcluster+"host_count", "The number of hosts in the host cluster.", labelnames_hostcluster, nil)
+	hostClusterMappedVolumes = prometheus.NewDesc(prefix_hostcluster+"mapped_volumes", "The number of volumes mapped to the host cluster or to any of its hosts.", labelnames_hostcluster, nil)
+	hostClusterMappedCapacity = prometheus.NewDesc(prefix_hostcluster+"mapped_capacity", "The total virtual capacity of the volumes mapped to the host cluster or to any of its hosts.", labelnames_hostcluster, nil)
+	return &hostVdiskMapCollector{}, nil
+}
+
+// Describe describes the metrics
+func (*hostVdiskMapCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	ch <- hostVolumeMappingInfo
+	ch <- hostMappedVolumes
+	ch <- hostMappedCapacity
+	ch <- hostClusterHostCount
+	ch <- hostClusterMappedVolumes
+	ch <- hostClusterMappedCapacity
+
+}
+
+// Collect collects metrics from Spectrum Virtualize Restful API
+func (c *hostVdiskMapCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+	logger.Debugln("entering hostvdiskmap collector ...")
+	volumeResp, err := sClient.CallSpectrumAPI(ctx, "lsvdisk", true)
+	if err != nil {
+		logger.Errorf("Executing lsvdisk cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lsvdisk: ", volumeResp)
+	if !gjson.Valid(volumeResp) {
+		return fmt.Errorf("invalid json for lsvdisk: %v", volumeResp)
+	}
+	// the capacity of each volume, by the id of the volume
+	volumeCapacities := make(map[string]uint64)
+	for _, volume := range gjson.Parse(volumeResp).Array() {
+		capacity_bytes, err := utils.ToBytes(volume.Get("capacity").String())
+		if err != nil {
+			logger.Errorf("Converting capacity unit failed: %s", err.Error())
+		}
+		volumeCapacities[volume.Get("id").String()] = capacity_bytes
+	}
+
+	hostResp, err := sClient.CallSpectrumAPI(ctx, "lshost", true)
+	if err != nil {
+		logger.Errorf("Executing lshost cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lshost: ", hostResp)
+	// This is a sample output of lshost
+	// [
+	//     {
+	//         "id": "0",
+	//         "name": "host0",
+	//         "port_count": "2",
+	//         "iogrp_count": "4",
+	//         "status": "online",
+	//         "site_id": "",
+	//         "site_name": "",
+	//         "host_cluster_id": "0",
+	//         "host_cluster_name": "hostcluster0",
+	//         "protocol": "scsi",
+	//         "owner_id": "",
+	//         "owner_name": ""
+	//     }
+	// ]
+	if !gjson.Valid(hostResp) {
+		return fmt.Errorf("invalid json for lshost: %v", hostResp)
+	}
+	// the hosts, in the order of lshost, and their host clusters
+	var hosts []string
+	hostClusters := make(map[string]string)
+	for _, host := range gjson.Parse(hostResp).Array() {
+		host_name := host.Get("name").String()
+		hosts = append(hosts, host_name)
+		hostClusters[host_name] = host.Get("host_cluster_name").String()
+	}
+
+	mapResp, err := sClient.CallSpectrumAPI(ctx, "lshostvdiskmap", true)
+	if err != nil {
+		logger.Errorf("Executing lshostvdiskmap cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lshostvdiskmap: ", mapResp)
+	// This is a sample output of lshostvdiskmap, a volume mapped to a host cluster is listed for each of its hosts
+	// [
+	//     {
+	//         "id": "0",
+	//         "name": "host0",
+	//         "SCSI_id": "0",
+	//         "vdisk_id": "3",
+	//         "vdisk_name": "vdisk3",
+	//         "vdisk_UID": "600507681081001D4800000000000004",
+	//         "IO_group_id": "0",
+	//         "IO_group_name": "io_grp0",
+	//         "mapping_type": "shared",
+	//         "host_cluster_id": "0",
+	//         "host_cluster_name": "hostcluster0",
+	//         "protocol": "scsi"
+	//     }
+	// ]
+	if !gjson.Valid(mapResp) {
+		return fmt.Errorf("invalid json for lshostvdiskmap: %v", mapResp)
+	}
+	hostVolumes := make(map[string]map[string]bool)
+	hostClusterVolumes := make(map[string]map[string]bool)
+	for _, mapping := range gjson.Parse(mapResp).Array() {
+		host_name := mapping.Get("name").String()
+		host_cluster := mapping.Get("host_cluster_name").String()
+		volume_id := mapping.Get("vdisk_id").String()
+		labelvalues := []string{sClient.Hostname, host_name, host_cluster, volume_id, mapping.Get("vdisk_name").String(), mapping.Get("SCSI_id").String(), mapping.Get("IO_group_name").String(), mapping.Get("mapping_type").String()}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(hostVolumeMappingInfo, prometheus.GaugeValue, 1, labelvalues...)
+
+		if hostVolumes[host_name] == nil {
+			hostVolumes[host_name] = make(map[string]bool)
+		}
+		hostVolumes[host_name][volume_id] = true
+		if host_cluster != "" {
+			if hostClusterVolumes[host_cluster] == nil {
+				hostClusterVolumes[host_cluster] = make(map[string]bool)
+			}
+			hostClusterVolumes[host_cluster][volume_id] = true
+		}
+	}
+	for _, host_name := range hosts {
+		labelvalues := []string{sClient.Hostname, host_name, hostClusters[host_name]}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		var capacity_bytes uint64
+		for volume_id := range hostVolumes[host_name] {
+			capacity_bytes += volumeCapacities[volume_id]
+		}
+		ch <- prometheus.MustNewConstMetric(hostMappedVolumes, prometheus.GaugeValue, float64(len(hostVolumes[host_name])), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(hostMappedCapacity, prometheus.GaugeValue, float64(capacity_bytes), labelvalues...)
+	}
+
+	hostClusterResp, err := sClient.CallSpectrumAPI(ctx, "lshostcluster", true)
+	if err != nil {
+		logger.Errorf("Executing lshostcluster cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lshostcluster: ", hostClusterResp)
+	// This is a sample output of lshostcluster
+	// [
+	//     {
+	//         "id": "0",
+	//         "name": "hostcluster0",
+	//         "status": "online",
+	//         "host_count": "2",
+	//         "mapping_count": "5",
+	//         "port_count": "4",
+	//         "protocol": "scsi",
+	//         "owner_id": "",
+	//         "owner_name": ""
+	//     }
+	// ]
+	if !gjson.Valid(hostClusterResp) {
+		return fmt.Errorf("invalid json for lshostcluster: %v", hostClusterResp)
+	}
+	for _, hostCluster := range gjson.Parse(hostClusterResp).Array() {
+		host_cluster := hostCluster.Get("name").String()
+		labelvalues := []string{sClient.Hostname, hostCluster.Get("id").String(), host_cluster}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		var capacity_bytes uint64
+		for volume_id := range hostClusterVolumes[host_cluster] {
+			capacity_bytes += volumeCapacities[volume_id]
+		}
+		ch <- prometheus.MustNewConstMetric(hostClusterHostCount, prometheus.GaugeValue, hostCluster.Get("host_count").Float(), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(hostClusterMappedVolumes, prometheus.GaugeValue, float64(len(hostClusterVolumes[host_cluster])), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(hostClusterMappedCapacity, prometheus.GaugeValue, float64(capacity_bytes), labelvalues...)
+	}
+	logger.Debugln("exit hostvdiskmap collector")
+	return nil
+}
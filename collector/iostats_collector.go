@@ -0,0 +1,418 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/spectrum-virtualize-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	prefix_iostats = "spectrum_iostats_"
+	iostatsDir     = "/dumps/iostats"
+	iostatsBlock   = 512 // the block counters of the statistics files count 512 byte blocks
+)
+
+var (
+	iostatsVolume iostatsDescs
+	iostatsMdisk  iostatsDescs
+	iostatsDrive  iostatsDescs
+
+	iostatsPortIOPS     *prometheus.Desc
+	iostatsPortTransmit *prometheus.Desc
+	iostatsPortReceive  *prometheus.Desc
+
+	// iostatsFileName matches the statistics files, e.g. Nv_stats_78N10WD-1_240105_103000
+	iostatsFileName = regexp.MustCompile(`^(N[vmdn])_stats_(.+)_(\d{6}_\d{6})$`)
+)
+
+// iostatsDescs are the rates of the volumes, MDisks or drives computed from two statistics files.
+type iostatsDescs struct {
+	readIOPS     *prometheus.Desc
+	writeIOPS    *prometheus.Desc
+	readBytes    *prometheus.Desc
+	writeBytes   *prometheus.Desc
+	readLatency  *prometheus.Desc
+	writeLatency *prometheus.Desc
+}
+
+func newIostatsDescs(object string, title string, labelnames []string) iostatsDescs {
+	return iostatsDescs{
+		readIOPS:     prometheus.NewDesc(prefix_iostats+object+"_read_iops", "The number of read operations per second of the "+title+" during the last statistics interval.", labelnames, nil),
+		writeIOPS:    prometheus.NewDesc(prefix_iostats+object+"_write_iops", "The number of write operations per second of the "+title+" during the last statistics interval.", labelnames, nil),
+		readBytes:    prometheus.NewDesc(prefix_iostats+object+"_read_bytes_per_second", "The number of bytes read per second from the "+title+" during the last statistics interval.", labelnames, nil),
+		writeBytes:   prometheus.NewDesc(prefix_iostats+object+"_write_bytes_per_second", "The number of bytes written per second to the "+title+" during the last statistics interval.", labelnames, nil),
+		readLatency:  prometheus.NewDesc(prefix_iostats+object+"_read_latency_seconds", "The average response time of the read operations of the "+title+" during the last statistics interval.", labelnames, nil),
+		writeLatency: prometheus.NewDesc(prefix_iostats+object+"_write_latency_seconds", "The average response time of the write operations of the "+title+" during the last statistics interval.", labelnames, nil),
+	}
+}
+
+func (d iostatsDescs) describe(ch chan<- *prometheus.Desc) {
+	ch <- d.readIOPS
+	ch <- d.writeIOPS
+	ch <- d.readBytes
+	ch <- d.writeBytes
+	ch <- d.readLatency
+	ch <- d.writeLatency
+}
+
+func init() {
+	registerCollector("iostats", defaultDisabled, NewIostatsCollector)
+}
+
+// iostatsCollector collects the performance of volumes, MDisks, drives and FC ports from the
+// statistics files the nodes write to /dumps/iostats every statistics interval.
+type iostatsCollector struct {
+	mutex sync.Mutex
+	// files caches the parsed statistics files, keyed by the target's IP address and the file name
+	files map[string]*iostatsFile
+}
+
+func NewIostatsCollector() (Collector, error) {
+	labelnames := []string{"resource", "node", "volume_id", "volume"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
+	}
+	iostatsVolume = newIostatsDescs("volume", "volume", labelnames)
+
+	labelnames = []string{"resource", "node", "mdisk_id", "mdisk"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
+	}
+	iostatsMdisk = newIostatsDescs("mdisk", "MDisk", labelnames)
+
+	labelnames = []string{"resource", "node", "drive_id"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
+	}
+	iostatsDrive = newIostatsDescs("drive", "drive", labelnames)
+
+	labelnames = []string{"resource", "node", "port_id", "wwpn"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
+	}
+	iostatsPortIOPS = prometheus.NewDesc(prefix_iostats+"fc_port_iops", "The number of exchanges per second sent and received by the FC port during the last statistics interval.", labelnames, nil)
+	iostatsPortTransmit = prometheus.NewDesc(prefix_iostats+"fc_port_transmit_bytes_per_second", "The number of bytes per second transmitted by the FC port during the last statistics interval.", labelnames, nil)
+	iostatsPortReceive = prometheus.NewDesc(prefix_iostats+"fc_port_receive_bytes_per_second", "The number of bytes per second received by the FC port during the last statistics interval.", labelnames, nil)
+
+	return &iostatsCollector{files: make(map[string]*iostatsFile)}, nil
+}
+
+// Describe describes the metrics
+func (*iostatsCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	iostatsVolume.describe(ch)
+	iostatsMdisk.describe(ch)
+	iostatsDrive.describe(ch)
+	ch <- iostatsPortIOPS
+	ch <- iostatsPortTransmit
+	ch <- iostatsPortReceive
+
+}
+
+// Collect collects metrics from Spectrum Virtualize Restful API
+func (c *iostatsCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+	logger.Debugln("entering iostats collector ...")
+	dumpsResp, err := sClient.CallSpectrumAPIWithParams(ctx, "lsdumps", map[string]string{"prefix": iostatsDir}, true)
+	if err != nil {
+		logger.Errorf("Executing lsdumps -prefix %s cmd failed: %s", iostatsDir, err.Error())
+		return err
+	}
+	logger.Debugln("response of lsdumps: ", dumpsResp)
+	// This is a sample output of lsdumps -prefix /dumps/iostats
+	// [
+	//     {
+	//         "id": "0",
+	//         "filename": "Nv_stats_78N10WD-1_240105_102500"
+	//     },
+	//     {
+	//         "id": "1",
+	//         "filename": "Nv_stats_78N10WD-1_240105_103000"
+	//     },
+	//     {
+	//         "id": "2",
+	//         "filename": "Nn_stats_78N10WD-1_240105_103000"
+	//     }
+	// ]
+	if !gjson.Valid(dumpsResp) {
+		return fmt.Errorf("invalid json for lsdumps: %v", dumpsResp)
+	}
+
+	// the files of each type and node, the newest two of them give the rates of the last interval
+	groups := make(map[string][]string)
+	for _, dump := range gjson.Parse(dumpsResp).Array() {
+		filename := dump.Get("filename").String()
+		m := iostatsFileName.FindStringSubmatch(filename)
+		if m == nil {
+			continue
+		}
+		key := m[1] + "/" + m[2]
+		groups[key] = append(groups[key], filename)
+	}
+
+	used := make(map[string]bool)
+	for key, filenames := range groups {
+		if len(filenames) < 2 {
+			logger.Debugf("iostats: waiting for a second statistics file of %s", key)
+			continue
+		}
+		// the file names end with the time, YYMMDD_hhmmss, so they sort by time
+		sort.Slice(filenames, func(i, j int) bool {
+			return iostatsFileName.FindStringSubmatch(filenames[i])[3] < iostatsFileName.FindStringSubmatch(filenames[j])[3]
+		})
+		previous, err := c.file(ctx, sClient, filenames[len(filenames)-2])
+		var current *iostatsFile
+		if err == nil {
+			current, err = c.file(ctx, sClient, filenames[len(filenames)-1])
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			// the statistics of the other types and nodes are still collected
+			logger.Errorf("Skipping the statistics files %s of %s: %s", key, sClient.IpAddress, err.Error())
+			continue
+		}
+		used[sClient.IpAddress+"/"+previous.name] = true
+		used[sClient.IpAddress+"/"+current.name] = true
+
+		seconds := current.time.Sub(previous.time).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+		switch current.kind {
+		case "Nv":
+			collectIostats(ch, iostatsVolume, sClient, previous, current, seconds, "rl", "wl", func(o iostatsObject) []string {
+				return []string{o.attrs["idx"], o.attrs["id"]}
+			})
+		case "Nm":
+			collectIostats(ch, iostatsMdisk, sClient, previous, current, seconds, "re", "we", func(o iostatsObject) []string {
+				return []string{o.attrs["idx"], o.attrs["id"]}
+			})
+		case "Nd":
+			collectIostats(ch, iostatsDrive, sClient, previous, current, seconds, "re", "we", func(o iostatsObject) []string {
+				return []string{o.attrs["idx"]}
+			})
+		case "Nn":
+			collectPortIostats(ch, sClient, previous, current, seconds)
+		}
+	}
+
+	// forget the files which were rotated out
+	c.mutex.Lock()
+	for key := range c.files {
+		if strings.HasPrefix(key, sClient.IpAddress+"/") && !used[key] {
+			delete(c.files, key)
+		}
+	}
+	c.mutex.Unlock()
+	logger.Debugln("exit iostats collector")
+	return nil
+}
+
+// file returns a parsed statistics file, it's only downloaded if it's not cached yet.
+func (c *iostatsCollector) file(ctx context.Context, sClient utils.SpectrumClient, filename string) (*iostatsFile, error) {
+	key := sClient.IpAddress + "/" + filename
+	c.mutex.Lock()
+	f, ok := c.files[key]
+	c.mutex.Unlock()
+	if ok {
+		return f, nil
+	}
+	// the download endpoint returns the content of a file under /dumps
+	fileResp, err := sClient.CallSpectrumAPIWithParams(ctx, "download", map[string]string{"prefix": iostatsDir, "filename": filename}, true)
+	if err != nil {
+		logger.Errorf("Downloading %s/%s failed: %s", iostatsDir, filename, err.Error())
+		return nil, err
+	}
+	f, err = parseIostatsFile(filename, fileResp)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	c.files[key] = f
+	c.mutex.Unlock()
+	return f, nil
+}
+
+// iostatsFile is a parsed statistics file. This is a shortened sample of a Nv_stats file:
+//
+//	<diskStatsColl scope="node" id="node1" cluster="cluster1" node_id="0x0000000000000001"
+//	  sizeUnits="512B" timeUnits="msec" contains="virtualDiskStats" timestamp="2024-01-05 10:30:00">
+//	  <vdsk idx="0" id="vol0" ro="1520" wo="8711" rb="97280" wb="557504" rl="1710" wl="6153" rlw="3230" wlw="11810" />
+//	</diskStatsColl>
+//
+// The Nm_stats and Nd_stats files contain mdsk elements with the external response times re and we,
+// the Nn_stats files contain port elements with the bytes (hbt, cbt, ...) and exchanges (het, cet, ...)
+// transmitted to and received from hosts, controllers, local and remote nodes.
+type iostatsFile struct {
+	name    string
+	kind    string // Nv, Nm, Nd or Nn
+	node    string
+	time    time.Time
+	objects map[string]iostatsObject // keyed by the idx or id attribute
+}
+
+type iostatsObject struct {
+	attrs map[string]string
+}
+
+// counter returns the value of a counter attribute.
+func (o iostatsObject) counter(name string) (float64, bool) {
+	v, err := strconv.ParseUint(o.attrs[name], 0, 64)
+	if err != nil {
+		return 0, false
+	}
+	return float64(v), true
+}
+
+func parseIostatsFile(filename string, content string) (*iostatsFile, error) {
+	m := iostatsFileName.FindStringSubmatch(filename)
+	if m == nil {
+		return nil, fmt.Errorf("invalid statistics file name: %s", filename)
+	}
+	// the time of the file name is the local time of the node, only the difference between files is used
+	t, err := time.Parse("060102_150405", m[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time of statistics file %s: %s", filename, err.Error())
+	}
+	var doc struct {
+		Attrs    []xml.Attr `xml:",any,attr"`
+		Elements []struct {
+			XMLName xml.Name
+			Attrs   []xml.Attr `xml:",any,attr"`
+		} `xml:",any"`
+	}
+	if err := xml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, fmt.Errorf("invalid xml of statistics file %s: %s", filename, err.Error())
+	}
+	f := &iostatsFile{name: filename, kind: m[1], node: m[2], time: t, objects: make(map[string]iostatsObject)}
+	for _, attr := range doc.Attrs {
+		if attr.Name.Local == "id" && attr.Value != "" {
+			f.node = attr.Value
+		}
+	}
+	for _, e := range doc.Elements {
+		o := iostatsObject{attrs: make(map[string]string)}
+		for _, attr := range e.Attrs {
+			o.attrs[attr.Name.Local] = attr.Value
+		}
+		switch {
+		case f.kind == "Nn" && e.XMLName.Local == "port":
+			f.objects[o.attrs["id"]] = o
+		case f.kind == "Nv" && e.XMLName.Local == "vdsk", (f.kind == "Nm" || f.kind == "Nd") && e.XMLName.Local == "mdsk":
+			f.objects[o.attrs["idx"]] = o
+		}
+	}
+	return f, nil
+}
+
+// collectIostats sends the rates of the volumes, MDisks or drives of two statistics files.
+// readLatency and writeLatency are the attributes of the cumulative response times in milliseconds.
+func collectIostats(ch chan<- prometheus.Metric, descs iostatsDescs, sClient utils.SpectrumClient, previous, current *iostatsFile, seconds float64, readLatency, writeLatency string, labels func(iostatsObject) []string) {
+	for key, o := range current.objects {
+		p, ok := previous.objects[key]
+		if !ok {
+			continue
+		}
+		deltas := make(map[string]float64)
+		for _, name := range []string{"ro", "wo", "rb", "wb", readLatency, writeLatency} {
+			v, ok1 := o.counter(name)
+			pv, ok2 := p.counter(name)
+			if !ok1 || !ok2 || v < pv {
+				// the counters were reset, e.g. by a node restart
+				deltas = nil
+				break
+			}
+			deltas[name] = v - pv
+		}
+		if deltas == nil {
+			continue
+		}
+		labelvalues := append([]string{sClient.Hostname, current.node}, labels(o)...)
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(descs.readIOPS, prometheus.GaugeValue, deltas["ro"]/seconds, labelvalues...)
+		ch <- prometheus.MustNewConstMetric(descs.writeIOPS, prometheus.GaugeValue, deltas["wo"]/seconds, labelvalues...)
+		ch <- prometheus.MustNewConstMetric(descs.readBytes, prometheus.GaugeValue, deltas["rb"]*iostatsBlock/seconds, labelvalues...)
+		ch <- prometheus.MustNewConstMetric(descs.writeBytes, prometheus.GaugeValue, deltas["wb"]*iostatsBlock/seconds, labelvalues...)
+		ch <- prometheus.MustNewConstMetric(descs.readLatency, prometheus.GaugeValue, averageLatency(deltas[readLatency], deltas["ro"]), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(descs.writeLatency, prometheus.GaugeValue, averageLatency(deltas[writeLatency], deltas["wo"]), labelvalues...)
+	}
+}
+
+// averageLatency returns the average response time in seconds of ops operations which took milliseconds in total.
+func averageLatency(milliseconds float64, ops float64) float64 {
+	if ops == 0 {
+		return 0
+	}
+	return milliseconds / ops / 1000
+}
+
+// collectPortIostats sends the rates of the FC ports of two Nn_stats files.
+func collectPortIostats(ch chan<- prometheus.Metric, sClient utils.SpectrumClient, previous, current *iostatsFile, seconds float64) {
+	for key, o := range current.objects {
+		p, ok := previous.objects[key]
+		if !ok || o.attrs["type"] != "FC" {
+			continue
+		}
+		// the traffic with hosts (h), controllers (c), local nodes (ln) and remote nodes (rm)
+		var transmitted, received, exchanges float64
+		reset := false
+		for _, peer := range []string{"h", "c", "ln", "rm"} {
+			for _, name := range []string{peer + "bt", peer + "br", peer + "et", peer + "er"} {
+				v, ok1 := o.counter(name)
+				pv, ok2 := p.counter(name)
+				if !ok1 || !ok2 {
+					continue
+				}
+				if v < pv {
+					reset = true
+					continue
+				}
+				switch name[len(name)-2:] {
+				case "bt":
+					transmitted += v - pv
+				case "br":
+					received += v - pv
+				default:
+					exchanges += v - pv
+				}
+			}
+		}
+		if reset {
+			continue
+		}
+		labelvalues := []string{sClient.Hostname, current.node, o.attrs["id"], o.attrs["wwpn"]}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(iostatsPortIOPS, prometheus.GaugeValue, exchanges/seconds, labelvalues...)
+		ch <- prometheus.MustNewConstMetric(iostatsPortTransmit, prometheus.GaugeValue, transmitted/seconds, labelvalues...)
+		ch <- prometheus.MustNewConstMetric(iostatsPortReceive, prometheus.GaugeValue, received/seconds, labelvalues...)
+	}
+}
@@ -15,6 +15,7 @@
 package collector
 
 import (
+	"context"
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tidwall/gjson"
@@ -48,10 +49,10 @@ func (*mdiskCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *mdiskCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *mdiskCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering MDisk collector ...")
-	mDiskResp, err := sClient.CallSpectrumAPI("lsmdisk", true)
+	mDiskResp, err := sClient.CallSpectrumAPI(ctx, "lsmdisk", true)
 	if err != nil {
 		logger.Errorf("executing lsmdisk cmd failed: %s", err.Error())
 		return err
@@ -15,6 +15,7 @@
 package collector
 
 import (
+	"context"
 	"strconv"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
@@ -97,10 +98,10 @@ func (*mdiskgrpCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *mdiskgrpCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *mdiskgrpCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering MDiskgrp collector ...")
-	mDiskGrpResp, err := sClient.CallSpectrumAPI("lsmdiskgrp", true)
+	mDiskGrpResp, err := sClient.CallSpectrumAPI(ctx, "lsmdiskgrp", true)
 	if err != nil {
 		logger.Errorf("Executing lsmdiskgrp cmd failed: %s", err.Error())
 		return err
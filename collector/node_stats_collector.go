@@ -15,6 +15,9 @@
 package collector
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tidwall/gjson"
@@ -23,86 +26,99 @@ import (
 const prefix_nodeStats = "spectrum_nodestats_"
 
 var (
-	nodeStats_metrics [46]*prometheus.Desc
+	nodeStats_metrics   map[string]*prometheus.Desc // keyed by stat_name
+	nodeStats_value     *prometheus.Desc            // stats without a metric of their own
+	nodeStats_peak      *prometheus.Desc
+	nodeStats_peak_time *prometheus.Desc
 )
 
-func init() {
-	registerCollector("lsnodestats", defaultDisabled, NewNodeStatsCollector)
-}
+// nodeStatsHelp is the help text of the known lsnodestats statistics, keyed by stat_name.
+var nodeStatsHelp = map[string]string{
+	"compression_cpu_pc": "The percentage of allocated CPU capacity that is used for compression.",
+	"cpu_pc":             "The percentage of allocated CPU capacity that is used for the system.",
 
-// nodeStatsCollector collects nodeStats metrics
-type nodeStatsCollector struct {
-}
+	"fc_mb": "The total number of megabytes transferred per second (MBps) for Fibre Channel traffic on the system. This value includes host I/O and any bandwidth that is used for communication within the system.",
+	"fc_io": "The total input/output (I/O) operations that are transferred per seconds for Fibre Channel traffic on the system. This value includes host I/O and any bandwidth that is used for communication within the system.",
 
-func NewNodeStatsCollector() (Collector, error) {
-	labelnames := []string{"resource", "node"}
-	if len(utils.ExtraLabelNames) > 0 {
-		labelnames = append(labelnames, utils.ExtraLabelNames...)
-	}
-	nodeStats_metrics = [46]*prometheus.Desc{
-		prometheus.NewDesc(prefix_nodeStats+"compression_cpu_pc", "The percentage of allocated CPU capacity that is used for compression.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"cpu_pc", "The percentage of allocated CPU capacity that is used for the system.", labelnames, nil),
+	"sas_mb": "The total number of megabytes transferred per second (MBps) for serial-attached SCSI (SAS) traffic on the system. This value includes host I/O and bandwidth that is used for background RAID activity.",
+	"sas_io": "The total I/O operations that are transferred per second for SAS traffic on the system. This value includes host I/O and bandwidth that is used for background RAID activity.",
 
-		prometheus.NewDesc(prefix_nodeStats+"fc_mb", "The total number of megabytes transferred per second (MBps) for Fibre Channel traffic on the system. This value includes host I/O and any bandwidth that is used for communication within the system.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"fc_io", "The total input/output (I/O) operations that are transferred per seconds for Fibre Channel traffic on the system. This value includes host I/O and any bandwidth that is used for communication within the system.", labelnames, nil),
+	"iscsi_mb": "The total number of megabytes transferred per second (MBps) for iSCSI traffic on the system.",
+	"iscsi_io": "The total I/O operations that are transferred per second for iSCSI traffic on the system.",
 
-		prometheus.NewDesc(prefix_nodeStats+"sas_mb", "The total number of megabytes transferred per second (MBps) for serial-attached SCSI (SAS) traffic on the system. This value includes host I/O and bandwidth that is used for background RAID activity.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"sas_io", "The total I/O operations that are transferred per second for SAS traffic on the system. This value includes host I/O and bandwidth that is used for background RAID activity.", labelnames, nil),
+	"write_cache_pc": "The percentage of the write cache usage for the node.",
+	"total_cache_pc": "The total percentage for both the write and read cache usage for the node.",
 
-		prometheus.NewDesc(prefix_nodeStats+"iscsi_mb", "The total number of megabytes transferred per second (MBps) for iSCSI traffic on the system.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"iscsi_io", "The total I/O operations that are transferred per second for iSCSI traffic on the system.", labelnames, nil),
+	"vdisk_mb": "The average number of megabytes transferred per second (MBps) for read and write operations to volumes during the sample period.",
+	"vdisk_io": "The average number of I/O operations that are transferred per second for read and write operations to volumes during the sample period.",
+	"vdisk_ms": "The average amount of time in milliseconds that the system takes to respond to read and write requests to volumes over the sample period.",
 
-		prometheus.NewDesc(prefix_nodeStats+"write_cache_pc", "The percentage of the write cache usage for the node.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"total_cache_pc", "The total percentage for both the write and read cache usage for the node.", labelnames, nil),
+	"mdisk_mb": "The average number of megabytes transferred per second (MBps) for read and write operations to MDisks during the sample period.",
+	"mdisk_io": "The average number of I/O operations that are transferred per second for read and write operations to MDisks during the sample period.",
+	"mdisk_ms": "The average amount of time in milliseconds that the system takes to respond to read and write requests to MDisks over the sample period.",
 
-		prometheus.NewDesc(prefix_nodeStats+"vdisk_mb", "The average number of megabytes transferred per second (MBps) for read and write operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"vdisk_io", "The average number of I/O operations that are transferred per second for read and write operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"vdisk_ms", "The average amount of time in milliseconds that the system takes to respond to read and write requests to volumes over the sample period.", labelnames, nil),
+	"drive_mb": "The average number of megabytes transferred per second (MBps) for read and write operations to drives during the sample period.",
+	"drive_io": "The average number of I/O operations that are transferred per second for read and write operations to drives during the sample period.",
+	"drive_ms": "The average amount of time in milliseconds that the system takes to respond to read and write requests to drives over the sample period.",
 
-		prometheus.NewDesc(prefix_nodeStats+"mdisk_mb", "The average number of megabytes transferred per second (MBps) for read and write operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"mdisk_io", "The average number of I/O operations that are transferred per second for read and write operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"mdisk_ms", "The average amount of time in milliseconds that the system takes to respond to read and write requests to MDisks over the sample period.", labelnames, nil),
+	"vdisk_r_mb": "The average number of megabytes transferred per second (MBps) for read operations to volumes during the sample period.",
+	"vdisk_r_io": "The average number of I/O operations that are transferred per second for read operations to volumes during the sample period.",
+	"vdisk_r_ms": "The average amount of time in milliseconds that the system takes to respond to read requests to volumes over the sample period.",
 
-		prometheus.NewDesc(prefix_nodeStats+"drive_mb", "The average number of megabytes transferred per second (MBps) for read and write operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"drive_io", "The average number of I/O operations that are transferred per second for read and write operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"drive_ms", "The average amount of time in milliseconds that the system takes to respond to read and write requests to drives over the sample period.", labelnames, nil),
+	"vdisk_w_mb": "The average number of megabytes transferred per second (MBps) for read and write operations to volumes during the sample period.",
+	"vdisk_w_io": "The average number of I/O operations that are transferred per second for write operations to volumes during the sample period.",
+	"vdisk_w_ms": "The average amount of time in milliseconds that the system takes to respond to write requests to volumes over the sample period.",
 
-		prometheus.NewDesc(prefix_nodeStats+"vdisk_r_mb", "The average number of megabytes transferred per second (MBps) for read operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"vdisk_r_io", "The average number of I/O operations that are transferred per second for read operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"vdisk_r_ms", "The average amount of time in milliseconds that the system takes to respond to read requests to volumes over the sample period.", labelnames, nil),
+	"mdisk_r_mb": "The average number of megabytes transferred per second (MBps) for read operations to MDisks during the sample period.",
+	"mdisk_r_io": "The average number of I/O operations that are transferred per second for read operations to MDisks during the sample period.",
+	"mdisk_r_ms": "The average amount of time in milliseconds that the system takes to respond to read requests to MDisks over the sample period.",
 
-		prometheus.NewDesc(prefix_nodeStats+"vdisk_w_mb", "The average number of megabytes transferred per second (MBps) for read and write operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"vdisk_w_io", "The average number of I/O operations that are transferred per second for write operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"vdisk_w_ms", "The average amount of time in milliseconds that the system takes to respond to write requests to volumes over the sample period.", labelnames, nil),
+	"mdisk_w_mb": "The average number of megabytes transferred per second (MBps) for write operations to MDisks during the sample period.",
+	"mdisk_w_io": "TThe average number of I/O operations that are transferred per second for write operations to MDisks during the sample period.",
+	"mdisk_w_ms": "the average amount of time in milliseconds that the system takes to respond to write requests to MDisks over the sample period.",
 
-		prometheus.NewDesc(prefix_nodeStats+"mdisk_r_mb", "The average number of megabytes transferred per second (MBps) for read operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"mdisk_r_io", "The average number of I/O operations that are transferred per second for read operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"mdisk_r_ms", "The average amount of time in milliseconds that the system takes to respond to read requests to MDisks over the sample period.", labelnames, nil),
+	"drive_r_mb": "The average number of megabytes transferred per second (MBps) for read operations to drives during the sample period.",
+	"drive_r_io": "The average number of I/O operations that are transferred per second for read operations to drives during the sample period.",
+	"drive_r_ms": "The average amount of time in milliseconds that the system takes to respond to read requests to drives over the sample period.",
 
-		prometheus.NewDesc(prefix_nodeStats+"mdisk_w_mb", "The average number of megabytes transferred per second (MBps) for write operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"mdisk_w_io", "TThe average number of I/O operations that are transferred per second for write operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"mdisk_w_ms", "the average amount of time in milliseconds that the system takes to respond to write requests to MDisks over the sample period.", labelnames, nil),
+	"drive_w_mb": "The average number of megabytes transferred per second (MBps) for write operations to drives during the sample period.",
+	"drive_w_io": "The average number of I/O operations that are transferred per second for write operations to drives during the sample period.",
+	"drive_w_ms": "The average amount of time in milliseconds that the system takes to respond write requests to drives over the sample period.",
 
-		prometheus.NewDesc(prefix_nodeStats+"drive_r_mb", "The average number of megabytes transferred per second (MBps) for read operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"drive_r_io", "The average number of I/O operations that are transferred per second for read operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"drive_r_ms", "The average amount of time in milliseconds that the system takes to respond to read requests to drives over the sample period.", labelnames, nil),
+	"iplink_mb":      "The average number of megabytes requested to be transferred per second (MBps) over the IP partnership link during the sample period. This value is calculated before any compression of the data takes place. This value does not include iSCSI host input/output (I/O) operations.",
+	"iplink_io":      "TThe total input/output (I/O) operations that are transferred per second for IP partnership traffic on the system.",
+	"iplink_comp_mb": "The average number of compressed megabytes transferred per second (MBps) over the IP Replication link during the sample period. This value is calculated after any compression of |the data takes place. This value does not include iSCSI host I/O operations.",
 
-		prometheus.NewDesc(prefix_nodeStats+"drive_w_mb", "The average number of megabytes transferred per second (MBps) for write operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"drive_w_io", "The average number of I/O operations that are transferred per second for write operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"drive_w_ms", "The average amount of time in milliseconds that the system takes to respond write requests to drives over the sample period.", labelnames, nil),
+	"cloud_up_mb":   "The average number of megabytes transferred per second (Mbps) for upload operations to a cloud account during the sample period.",
+	"cloud_up_ms":   "The average amount of time (in milliseconds) it takes for the system to respond to upload requests to a cloud account during the sample period.",
+	"cloud_down_mb": "The average number of Mbps for download operations to a cloud account during the sample period.",
+	"cloud_down_ms": "The average amount of time (in milliseconds) it takes for the system to respond to download requests to a cloud account during the sample period.",
 
-		prometheus.NewDesc(prefix_nodeStats+"iplink_mb", "The average number of megabytes requested to be transferred per second (MBps) over the IP partnership link during the sample period. This value is calculated before any compression of the data takes place. This value does not include iSCSI host input/output (I/O) operations.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"iplink_io", "TThe total input/output (I/O) operations that are transferred per second for IP partnership traffic on the system.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"iplink_comp_mb", "The average number of compressed megabytes transferred per second (MBps) over the IP Replication link during the sample period. This value is calculated after any compression of |the data takes place. This value does not include iSCSI host I/O operations.", labelnames, nil),
+	"iser_mb": "The total number of megabytes transferred per second (MBps) for iSER traffic on the system.",
+	"iser_io": "The total I/O operations that are transferred per second for iSER traffic on the system.",
+}
 
-		prometheus.NewDesc(prefix_nodeStats+"cloud_up_mb", "The average number of megabytes transferred per second (Mbps) for upload operations to a cloud account during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"cloud_up_ms", "The average amount of time (in milliseconds) it takes for the system to respond to upload requests to a cloud account during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"cloud_down_mb", "The average number of Mbps for download operations to a cloud account during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"cloud_down_ms", "The average amount of time (in milliseconds) it takes for the system to respond to download requests to a cloud account during the sample period.", labelnames, nil),
+func init() {
+	registerCollector("lsnodestats", defaultDisabled, NewNodeStatsCollector)
+}
 
-		prometheus.NewDesc(prefix_nodeStats+"iser_mb", "The total number of megabytes transferred per second (MBps) for iSER traffic on the system.", labelnames, nil),
-		prometheus.NewDesc(prefix_nodeStats+"iser_io", "The total I/O operations that are transferred per second for iSER traffic on the system.", labelnames, nil),
+// nodeStatsCollector collects nodeStats metrics
+type nodeStatsCollector struct {
+}
+
+func NewNodeStatsCollector() (Collector, error) {
+	labelnames := []string{"resource", "node"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
 	}
+	nodeStats_metrics = make(map[string]*prometheus.Desc)
+	for statName, help := range nodeStatsHelp {
+		nodeStats_metrics[statName] = prometheus.NewDesc(prefix_nodeStats+statName, help, labelnames, nil)
+	}
+	statLabelnames := append([]string{"resource", "node", "stat"}, utils.ExtraLabelNames...)
+	nodeStats_value = prometheus.NewDesc(prefix_nodeStats+"value", "The current value of a node statistic which has no metric of its own, e.g. one added by a firmware upgrade.", statLabelnames, nil)
+	nodeStats_peak = prometheus.NewDesc(prefix_nodeStats+"peak", "The peak value of a node statistic over the last 5 minutes.", statLabelnames, nil)
+	nodeStats_peak_time = prometheus.NewDesc(prefix_nodeStats+"peak_timestamp_seconds", "Unix time when a node statistic reached its peak value.", statLabelnames, nil)
 
 	return &nodeStatsCollector{}, nil
 }
@@ -113,14 +129,17 @@ func (*nodeStatsCollector) Describe(ch chan<- *prometheus.Desc) {
 	for _, nodestat_metric := range nodeStats_metrics {
 		ch <- nodestat_metric
 	}
+	ch <- nodeStats_value
+	ch <- nodeStats_peak
+	ch <- nodeStats_peak_time
 
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *nodeStatsCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *nodeStatsCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering NodeStats collector ...")
-	nodeStatsResp, err := sClient.CallSpectrumAPI("lsnodestats", true)
+	nodeStatsResp, err := sClient.CallSpectrumAPI(ctx, "lsnodestats", true)
 	if err != nil {
 		logger.Errorf("Executing lsnodestats cmd failed: %s", err.Error())
 		return err
@@ -182,14 +201,34 @@ func (c *nodeStatsCollector) Collect(sClient utils.SpectrumClient, ch chan<- pro
 	// ....
 	// ]
 
+	if !gjson.Valid(nodeStatsResp) {
+		return fmt.Errorf("invalid json for lsnodestats: %v", nodeStatsResp)
+	}
+	// the stats are matched by node and stat_name, a node which is offline has no stats at all
 	nodeStatsArray := gjson.Parse(nodeStatsResp).Array()
-	nodesNumber := len(nodeStatsArray) / len(nodeStats_metrics)
+	for _, nodeStat := range nodeStatsArray {
+		node := nodeStat.Get("node_name").String()
+		if node == "" {
+			node = nodeStat.Get("node_id").String()
+		}
+		statName := nodeStat.Get("stat_name").String()
+		labelvalues := []string{sClient.Hostname, node}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		statLabelvalues := append([]string{sClient.Hostname, node, statName}, utils.ExtraLabelValues...)
 
-	for i, nodeStats_metric := range nodeStats_metrics {
-		for node := 0; node < nodesNumber; node++ {
-			index := len(nodeStats_metrics)*node + i
-			labelvalues := []string{sClient.Hostname, nodeStatsArray[index].Get("node_name").String()}
-			ch <- prometheus.MustNewConstMetric(nodeStats_metric, prometheus.GaugeValue, nodeStatsArray[index].Get("stat_current").Float(), labelvalues...)
+		value := nodeStat.Get("stat_current").Float()
+		if nodeStats_metric, ok := nodeStats_metrics[statName]; ok {
+			ch <- prometheus.MustNewConstMetric(nodeStats_metric, prometheus.GaugeValue, value, labelvalues...)
+		} else {
+			ch <- prometheus.MustNewConstMetric(nodeStats_value, prometheus.GaugeValue, value, statLabelvalues...)
+		}
+		ch <- prometheus.MustNewConstMetric(nodeStats_peak, prometheus.GaugeValue, nodeStat.Get("stat_peak").Float(), statLabelvalues...)
+		if peakTime, err := parseStatPeakTime(sClient, nodeStat.Get("stat_peak_time").String()); err == nil {
+			ch <- prometheus.MustNewConstMetric(nodeStats_peak_time, prometheus.GaugeValue, float64(peakTime.Unix()), statLabelvalues...)
+		} else {
+			logger.Debugf("invalid stat_peak_time of %s on %s: %s", statName, node, err.Error())
 		}
 	}
 	logger.Debugln("exit NodeStats collector")
@@ -0,0 +1,175 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IBM/spectrum-virtualize-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+const prefix_partnership = "spectrum_partnership_"
+
+var (
+	partnership_state                *prometheus.Desc
+	partnership_link_bandwidth       *prometheus.Desc
+	partnership_background_copy_rate *prometheus.Desc
+)
+
+func init() {
+	registerCollector("lspartnership", defaultDisabled, NewPartnershipCollector)
+}
+
+// partnershipCollector collects the metrics of the partnerships with remote systems
+type partnershipCollector struct {
+}
+
+func NewPartnershipCollector() (Collector, error) {
+	labelnames := []string{"resource", "partnership_id", "partnership_name", "type"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
+	}
+	partnership_state = prometheus.NewDesc(prefix_partnership+"state", "The state of the partnership with the remote system. -1-unknown; 0-fully_configured; 1-partially_configured_local; 2-partially_configured_local_stopped; 3-not_present; 4-fully_configured_stopped; 5-fully_configured_remote_stopped; 6-fully_configured_local_excluded; 7-fully_configured_remote_excluded; 8-fully_configured_exceeded.", labelnames, nil)
+	partnership_link_bandwidth = prometheus.NewDesc(prefix_partnership+"link_bandwidth_bits_per_second", "The bandwidth of the link to the remote system which is available for replication.", labelnames, nil)
+	partnership_background_copy_rate = prometheus.NewDesc(prefix_partnership+"background_copy_rate", "The percentage of the link bandwidth which can be used for background copy operations.", labelnames, nil)
+	return &partnershipCollector{}, nil
+}
+
+// Describe describes the metrics
+func (*partnershipCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	ch <- partnership_state
+	ch <- partnership_link_bandwidth
+	ch <- partnership_background_copy_rate
+
+}
+
+// Collect collects metrics from Spectrum Virtualize Restful API
+func (c *partnershipCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+	logger.Debugln("entering partnership collector ...")
+	partnershipResp, err := sClient.CallSpectrumAPI(ctx, "lspartnership", true)
+	if err != nil {
+		logger.Errorf("Executing lspartnership cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lspartnership: ", partnershipResp)
+	// This is a sample output of lspartnership
+	// [
+	//     {
+	//         "id": "0000020060C14FBE",
+	//         "name": "cluster1",
+	//         "location": "local",
+	//         "partnership": "",
+	//         "type": "",
+	//         "cluster_ip": "",
+	//         "event_log_sequence": ""
+	//     },
+	//     {
+	//         "id": "0000020060A14FAE",
+	//         "name": "cluster2",
+	//         "location": "remote",
+	//         "partnership": "fully_configured",
+	//         "type": "fc",
+	//         "cluster_ip": "",
+	//         "event_log_sequence": ""
+	//     }
+	// ]
+	if !gjson.Valid(partnershipResp) {
+		return fmt.Errorf("invalid json for lspartnership: %v", partnershipResp)
+	}
+	for _, partnership := range gjson.Parse(partnershipResp).Array() {
+		// the local system is listed as well, it has no partnership with itself
+		if partnership.Get("location").String() == "local" {
+			continue
+		}
+		partnership_id := partnership.Get("id").String()
+		labelvalues := []string{sClient.Hostname, partnership_id, partnership.Get("name").String(), partnership.Get("type").String()}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		v_state := -1
+		switch partnership.Get("partnership").String() {
+		case "fully_configured":
+			v_state = 0
+		case "partially_configured_local":
+			v_state = 1
+		case "partially_configured_local_stopped":
+			v_state = 2
+		case "not_present":
+			v_state = 3
+		case "fully_configured_stopped":
+			v_state = 4
+		case "fully_configured_remote_stopped":
+			v_state = 5
+		case "fully_configured_local_excluded":
+			v_state = 6
+		case "fully_configured_remote_excluded":
+			v_state = 7
+		case "fully_configured_exceeded":
+			v_state = 8
+		}
+		ch <- prometheus.MustNewConstMetric(partnership_state, prometheus.GaugeValue, float64(v_state), labelvalues...)
+
+		// the bandwidth is only in the detailed view of the partnership
+		partnershipDetailResp, err := sClient.CallSpectrumAPI(ctx, "lspartnership/"+partnership_id, true)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			// the metrics of the other partnerships are still collected
+			logger.Errorf("Executing lspartnership/%s cmd failed: %s", partnership_id, err.Error())
+			continue
+		}
+		logger.Debugf("response of lspartnership/%s: %s", partnership_id, partnershipDetailResp)
+		// This is a sample output of lspartnership/<id>
+		// {
+		//     "id": "0000020060A14FAE",
+		//     "name": "cluster2",
+		//     "location": "remote",
+		//     "partnership": "fully_configured",
+		//     "code_level": "8.6.0.2 (build 170.9.2310191223000)",
+		//     "console_IP": "9.71.50.32:443",
+		//     "gm_link_tolerance": "300",
+		//     "gm_inter_cluster_delay_simulation": "0",
+		//     "gm_intra_cluster_delay_simulation": "0",
+		//     "relationship_bandwidth_limit": "25",
+		//     "gm_max_host_delay": "5",
+		//     "type": "fc",
+		//     "cluster_ip": "",
+		//     "chap_secret": "",
+		//     "event_log_sequence": "",
+		//     "link_bandwidth_mbits": "1000",
+		//     "background_copy_rate": "50",
+		//     "max_replication_delay": "0",
+		//     "compressed": "no"
+		// }
+		if !gjson.Valid(partnershipDetailResp) {
+			logger.Errorf("invalid json for lspartnership/%s: %v", partnership_id, partnershipDetailResp)
+			continue
+		}
+		partnershipDetail := gjson.Parse(partnershipDetailResp)
+		if partnershipDetail.Get("link_bandwidth_mbits").Exists() {
+			ch <- prometheus.MustNewConstMetric(partnership_link_bandwidth, prometheus.GaugeValue, partnershipDetail.Get("link_bandwidth_mbits").Float()*1000000, labelvalues...)
+		}
+		if partnershipDetail.Get("background_copy_rate").Exists() {
+			ch <- prometheus.MustNewConstMetric(partnership_background_copy_rate, prometheus.GaugeValue, partnershipDetail.Get("background_copy_rate").Float(), labelvalues...)
+		}
+	}
+	logger.Debugln("exit partnership collector")
+	return nil
+}
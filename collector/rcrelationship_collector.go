@@ -0,0 +1,237 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/IBM/spectrum-virtualize-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	prefix_rcrelationship = "spectrum_rcrelationship_"
+	prefix_rcconsistgrp   = "spectrum_rcconsistgrp_"
+	rcStates              = "-1-unknown; 0-consistent_synchronized; 1-consistent_copying; 2-consistent_stopped; 3-consistent_disconnected; 4-inconsistent_copying; 5-inconsistent_stopped; 6-inconsistent_disconnected; 7-idling; 8-idling_disconnected; 9-empty."
+)
+
+var (
+	rcrelationship_state       *prometheus.Desc
+	rcrelationship_progress    *prometheus.Desc
+	rcrelationship_freeze_time *prometheus.Desc
+
+	rcconsistgrp_state              *prometheus.Desc
+	rcconsistgrp_relationship_count *prometheus.Desc
+	rcconsistgrp_freeze_time        *prometheus.Desc
+)
+
+func init() {
+	registerCollector("lsrcrelationship", defaultDisabled, NewRCRelationshipCollector)
+	registerCollector("lsrcconsistgrp", defaultDisabled, NewRCConsistGrpCollector)
+}
+
+// rcState returns the value of the state of a remote copy relationship or consistency group.
+func rcState(state string) int {
+	switch state {
+	case "consistent_synchronized":
+		return 0
+	case "consistent_copying":
+		return 1
+	case "consistent_stopped":
+		return 2
+	case "consistent_disconnected":
+		return 3
+	case "inconsistent_copying":
+		return 4
+	case "inconsistent_stopped":
+		return 5
+	case "inconsistent_disconnected":
+		return 6
+	case "idling":
+		return 7
+	case "idling_disconnected":
+		return 8
+	case "empty":
+		return 9
+	}
+	return -1
+}
+
+// parseFreezeTime parses the freeze_time of a relationship or consistency group, YYYY/MM/DD/hh/mm.
+func parseFreezeTime(sClient utils.SpectrumClient, s string) (time.Time, error) {
+	return sClient.ParseTime("2006/01/02/15/04", s)
+}
+
+// rcRelationshipCollector collects remote copy relationship metrics
+type rcRelationshipCollector struct {
+}
+
+func NewRCRelationshipCollector() (Collector, error) {
+	labelnames := []string{"resource", "relationship_id", "relationship_name", "master_cluster_name", "master_volume_name", "aux_cluster_name", "aux_volume_name", "consistency_group_name", "copy_type"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
+	}
+	rcrelationship_state = prometheus.NewDesc(prefix_rcrelationship+"state", "The state of the remote copy relationship. "+rcStates, labelnames, nil)
+	rcrelationship_progress = prometheus.NewDesc(prefix_rcrelationship+"progress", "The percentage of the initial background copy or resynchronization of the remote copy relationship that is complete.", labelnames, nil)
+	rcrelationship_freeze_time = prometheus.NewDesc(prefix_rcrelationship+"freeze_timestamp_seconds", "The time of the last consistent image of the secondary volume of a Global Mirror with change volumes relationship.", labelnames, nil)
+	return &rcRelationshipCollector{}, nil
+}
+
+// Describe describes the metrics
+func (*rcRelationshipCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	ch <- rcrelationship_state
+	ch <- rcrelationship_progress
+	ch <- rcrelationship_freeze_time
+
+}
+
+// Collect collects metrics from Spectrum Virtualize Restful API
+func (c *rcRelationshipCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+	logger.Debugln("entering rcrelationship collector ...")
+	rcRelationshipResp, err := sClient.CallSpectrumAPI(ctx, "lsrcrelationship", true)
+	if err != nil {
+		logger.Errorf("Executing lsrcrelationship cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lsrcrelationship: ", rcRelationshipResp)
+	// This is a sample output of lsrcrelationship
+	// [
+	//     {
+	//         "id": "12",
+	//         "name": "rcrel0",
+	//         "master_cluster_id": "0000020060C14FBE",
+	//         "master_cluster_name": "cluster1",
+	//         "master_vdisk_id": "12",
+	//         "master_vdisk_name": "vdisk12",
+	//         "aux_cluster_id": "0000020060A14FAE",
+	//         "aux_cluster_name": "cluster2",
+	//         "aux_vdisk_id": "12",
+	//         "aux_vdisk_name": "vdisk12",
+	//         "primary": "master",
+	//         "consistency_group_id": "0",
+	//         "consistency_group_name": "rccstgrp0",
+	//         "state": "consistent_synchronized",
+	//         "bg_copy_priority": "50",
+	//         "progress": "",
+	//         "copy_type": "global",
+	//         "cycling_mode": "multi",
+	//         "freeze_time": "2024/01/05/10/30"
+	//     }
+	// ]
+	if !gjson.Valid(rcRelationshipResp) {
+		return fmt.Errorf("invalid json for lsrcrelationship: %v", rcRelationshipResp)
+	}
+	for _, rel := range gjson.Parse(rcRelationshipResp).Array() {
+		labelvalues := []string{sClient.Hostname, rel.Get("id").String(), rel.Get("name").String(), rel.Get("master_cluster_name").String(), rel.Get("master_vdisk_name").String(), rel.Get("aux_cluster_name").String(), rel.Get("aux_vdisk_name").String(), rel.Get("consistency_group_name").String(), rel.Get("copy_type").String()}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(rcrelationship_state, prometheus.GaugeValue, float64(rcState(rel.Get("state").String())), labelvalues...)
+		// the progress is blank unless the relationship is copying, a synchronized relationship is complete
+		progress := rel.Get("progress").String()
+		if progress != "" {
+			ch <- prometheus.MustNewConstMetric(rcrelationship_progress, prometheus.GaugeValue, gjson.Parse(progress).Float(), labelvalues...)
+		} else if rel.Get("state").String() == "consistent_synchronized" {
+			ch <- prometheus.MustNewConstMetric(rcrelationship_progress, prometheus.GaugeValue, 100, labelvalues...)
+		}
+		if freezeTime := rel.Get("freeze_time").String(); freezeTime != "" {
+			t, err := parseFreezeTime(sClient, freezeTime)
+			if err != nil {
+				logger.Errorf("Parsing freeze_time %s failed: %s", freezeTime, err.Error())
+			} else {
+				ch <- prometheus.MustNewConstMetric(rcrelationship_freeze_time, prometheus.GaugeValue, float64(t.Unix()), labelvalues...)
+			}
+		}
+	}
+	logger.Debugln("exit rcrelationship collector")
+	return nil
+}
+
+// rcConsistGrpCollector collects remote copy consistency group metrics
+type rcConsistGrpCollector struct {
+}
+
+func NewRCConsistGrpCollector() (Collector, error) {
+	labelnames := []string{"resource", "group_id", "group_name", "master_cluster_name", "aux_cluster_name", "copy_type"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
+	}
+	rcconsistgrp_state = prometheus.NewDesc(prefix_rcconsistgrp+"state", "The state of the remote copy consistency group. "+rcStates, labelnames, nil)
+	rcconsistgrp_relationship_count = prometheus.NewDesc(prefix_rcconsistgrp+"relationship_count", "The number of relationships in the remote copy consistency group.", labelnames, nil)
+	rcconsistgrp_freeze_time = prometheus.NewDesc(prefix_rcconsistgrp+"freeze_timestamp_seconds", "The time of the last consistent image of the secondary volumes of a Global Mirror with change volumes consistency group.", labelnames, nil)
+	return &rcConsistGrpCollector{}, nil
+}
+
+// Describe describes the metrics
+func (*rcConsistGrpCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	ch <- rcconsistgrp_state
+	ch <- rcconsistgrp_relationship_count
+	ch <- rcconsistgrp_freeze_time
+
+}
+
+// Collect collects metrics from Spectrum Virtualize Restful API
+func (c *rcConsistGrpCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+	logger.Debugln("entering rcconsistgrp collector ...")
+	rcConsistGrpResp, err := sClient.CallSpectrumAPI(ctx, "lsrcconsistgrp", true)
+	if err != nil {
+		logger.Errorf("Executing lsrcconsistgrp cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lsrcconsistgrp: ", rcConsistGrpResp)
+	// This is a sample output of lsrcconsistgrp
+	// [
+	//     {
+	//         "id": "0",
+	//         "name": "rccstgrp0",
+	//         "master_cluster_id": "0000020060C14FBE",
+	//         "master_cluster_name": "cluster1",
+	//         "aux_cluster_id": "0000020060A14FAE",
+	//         "aux_cluster_name": "cluster2",
+	//         "primary": "master",
+	//         "state": "consistent_synchronized",
+	//         "relationship_count": "2",
+	//         "copy_type": "global",
+	//         "cycling_mode": "multi",
+	//         "freeze_time": "2024/01/05/10/30"
+	//     }
+	// ]
+	if !gjson.Valid(rcConsistGrpResp) {
+		return fmt.Errorf("invalid json for lsrcconsistgrp: %v", rcConsistGrpResp)
+	}
+	for _, group := range gjson.Parse(rcConsistGrpResp).Array() {
+		labelvalues := []string{sClient.Hostname, group.Get("id").String(), group.Get("name").String(), group.Get("master_cluster_name").String(), group.Get("aux_cluster_name").String(), group.Get("copy_type").String()}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(rcconsistgrp_state, prometheus.GaugeValue, float64(rcState(group.Get("state").String())), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(rcconsistgrp_relationship_count, prometheus.GaugeValue, group.Get("relationship_count").Float(), labelvalues...)
+		if freezeTime := group.Get("freeze_time").String(); freezeTime != "" {
+			t, err := parseFreezeTime(sClient, freezeTime)
+			if err != nil {
+				logger.Errorf("Parsing freeze_time %s failed: %s", freezeTime, err.Error())
+			} else {
+				ch <- prometheus.MustNewConstMetric(rcconsistgrp_freeze_time, prometheus.GaugeValue, float64(t.Unix()), labelvalues...)
+			}
+		}
+	}
+	logger.Debugln("exit rcconsistgrp collector")
+	return nil
+}
@@ -15,6 +15,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 
@@ -143,9 +144,9 @@ func (*systemCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *systemCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *systemCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 	logger.Debugln("entering System collector ...")
-	systemMetrics, err := sClient.CallSpectrumAPI("lssystem", true)
+	systemMetrics, err := sClient.CallSpectrumAPI(ctx, "lssystem", true)
 	// This is a sample output of lssystem
 	// {
 	// 	"id": "0000020420400752",
@@ -416,7 +417,7 @@ func (c *systemCollector) Collect(sClient utils.SpectrumClient, ch chan<- promet
 	compression_savings := compression_uncompressed_capacity_bytes - compression_compressed_capacity_bytes + used_capacity_before_reduction_bytes - used_capacity_after_reduction_bytes + total_reclaimable_capacity_bytes
 	deduplication_savings := deduplication_capacity_saving_bytes
 	total_provisioned := total_vdiskcopy_capacity_bytes
-	mDiskResp, err := sClient.CallSpectrumAPI("lsmdisk", true)
+	mDiskResp, err := sClient.CallSpectrumAPI(ctx, "lsmdisk", true)
 	if err != nil {
 		logger.Errorf("Executing lsmdisk cmd failed: %s", err.Error())
 		return err
@@ -452,7 +453,7 @@ func (c *systemCollector) Collect(sClient utils.SpectrumClient, ch chan<- promet
 	var drive_thin_savings uint64
 	for _, mdisk := range mDisks {
 		mdisk_name := mdisk.Get("name").String()
-		mDiskDetailResp, err := sClient.CallSpectrumAPI("lsmdisk/"+mdisk_name, true)
+		mDiskDetailResp, err := sClient.CallSpectrumAPI(ctx, "lsmdisk/"+mdisk_name, true)
 		if err != nil {
 			logger.Errorf("Executing lsmdisk/%s cmd failed: %s", mdisk_name, err)
 			return err
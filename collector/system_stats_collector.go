@@ -15,7 +15,9 @@
 package collector
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
@@ -25,88 +27,101 @@ import (
 const prefix_stats = "spectrum_systemstats_"
 
 var (
-	metrics [49]*prometheus.Desc
+	systemStats_metrics   map[string]*prometheus.Desc // keyed by stat_name
+	systemStats_value     *prometheus.Desc            // stats without a metric of their own
+	systemStats_peak      *prometheus.Desc
+	systemStats_peak_time *prometheus.Desc
 )
 
-type systemStatsCollector struct {
-}
+// systemStatsHelp is the help text of the known lssystemstats statistics, keyed by stat_name.
+var systemStatsHelp = map[string]string{
+	"compression_cpu_pc": "The percentage of allocated CPU capacity that is used for compression.",
+	"cpu_pc":             "The percentage of allocated CPU capacity that is used for the system.",
 
-func init() {
-	registerCollector("lssystemstats", defaultEnabled, NewSystemStatsCollector)
-}
-func NewSystemStatsCollector() (Collector, error) {
-	labelnames := []string{"resource"}
-	if len(utils.ExtraLabelNames) > 0 {
-		labelnames = append(labelnames, utils.ExtraLabelNames...)
-	}
-	metrics = [49]*prometheus.Desc{
-		prometheus.NewDesc(prefix_stats+"compression_cpu_pc", "The percentage of allocated CPU capacity that is used for compression.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"cpu_pc", "The percentage of allocated CPU capacity that is used for the system.", labelnames, nil),
+	"fc_mb": "The total number of megabytes transferred per second (MBps) for Fibre Channel traffic on the system. This value includes host I/O and any bandwidth that is used for communication within the system.",
+	"fc_io": "The total input/output (I/O) operations that are transferred per seconds for Fibre Channel traffic on the system. This value includes host I/O and any bandwidth that is used for communication within the system.",
 
-		prometheus.NewDesc(prefix_stats+"fc_mb", "The total number of megabytes transferred per second (MBps) for Fibre Channel traffic on the system. This value includes host I/O and any bandwidth that is used for communication within the system.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"fc_io", "The total input/output (I/O) operations that are transferred per seconds for Fibre Channel traffic on the system. This value includes host I/O and any bandwidth that is used for communication within the system.", labelnames, nil),
+	"sas_mb": "The total number of megabytes transferred per second (MBps) for serial-attached SCSI (SAS) traffic on the system. This value includes host I/O and bandwidth that is used for background RAID activity.",
+	"sas_io": "The total I/O operations that are transferred per second for SAS traffic on the system. This value includes host I/O and bandwidth that is used for background RAID activity.",
 
-		prometheus.NewDesc(prefix_stats+"sas_mb", "The total number of megabytes transferred per second (MBps) for serial-attached SCSI (SAS) traffic on the system. This value includes host I/O and bandwidth that is used for background RAID activity.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"sas_io", "The total I/O operations that are transferred per second for SAS traffic on the system. This value includes host I/O and bandwidth that is used for background RAID activity.", labelnames, nil),
+	"iscsi_mb": "The total number of megabytes transferred per second (MBps) for iSCSI traffic on the system.",
+	"iscsi_io": "The total I/O operations that are transferred per second for iSCSI traffic on the system.",
 
-		prometheus.NewDesc(prefix_stats+"iscsi_mb", "The total number of megabytes transferred per second (MBps) for iSCSI traffic on the system.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"iscsi_io", "The total I/O operations that are transferred per second for iSCSI traffic on the system.", labelnames, nil),
+	"write_cache_pc": "The percentage of the write cache usage for the node.",
+	"total_cache_pc": "The total percentage for both the write and read cache usage for the node.",
 
-		prometheus.NewDesc(prefix_stats+"write_cache_pc", "The percentage of the write cache usage for the node.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"total_cache_pc", "The total percentage for both the write and read cache usage for the node.", labelnames, nil),
+	"vdisk_mb": "The average number of megabytes transferred per second (MBps) for read and write operations to volumes during the sample period.",
+	"vdisk_io": "The average number of I/O operations that are transferred per second for read and write operations to volumes during the sample period.",
+	"vdisk_ms": "The average amount of time in milliseconds that the system takes to respond to read and write requests to volumes over the sample period.",
 
-		prometheus.NewDesc(prefix_stats+"vdisk_mb", "The average number of megabytes transferred per second (MBps) for read and write operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"vdisk_io", "The average number of I/O operations that are transferred per second for read and write operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"vdisk_ms", "The average amount of time in milliseconds that the system takes to respond to read and write requests to volumes over the sample period.", labelnames, nil),
+	"mdisk_mb": "The average number of megabytes transferred per second (MBps) for read and write operations to MDisks during the sample period.",
+	"mdisk_io": "The average number of I/O operations that are transferred per second for read and write operations to MDisks during the sample period.",
+	"mdisk_ms": "The average amount of time in milliseconds that the system takes to respond to read and write requests to MDisks over the sample period.",
 
-		prometheus.NewDesc(prefix_stats+"mdisk_mb", "The average number of megabytes transferred per second (MBps) for read and write operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"mdisk_io", "The average number of I/O operations that are transferred per second for read and write operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"mdisk_ms", "The average amount of time in milliseconds that the system takes to respond to read and write requests to MDisks over the sample period.", labelnames, nil),
+	"drive_mb": "The average number of megabytes transferred per second (MBps) for read and write operations to drives during the sample period.",
+	"drive_io": "The average number of I/O operations that are transferred per second for read and write operations to drives during the sample period.",
+	"drive_ms": "The average amount of time in milliseconds that the system takes to respond to read and write requests to drives over the sample period.",
 
-		prometheus.NewDesc(prefix_stats+"drive_mb", "The average number of megabytes transferred per second (MBps) for read and write operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"drive_io", "The average number of I/O operations that are transferred per second for read and write operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"drive_ms", "The average amount of time in milliseconds that the system takes to respond to read and write requests to drives over the sample period.", labelnames, nil),
+	"vdisk_r_mb": "The average number of megabytes transferred per second (MBps) for read operations to volumes during the sample period.",
+	"vdisk_r_io": "The average number of I/O operations that are transferred per second for read operations to volumes during the sample period.",
+	"vdisk_r_ms": "The average amount of time in milliseconds that the system takes to respond to read requests to volumes over the sample period.",
 
-		prometheus.NewDesc(prefix_stats+"vdisk_r_mb", "The average number of megabytes transferred per second (MBps) for read operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"vdisk_r_io", "The average number of I/O operations that are transferred per second for read operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"vdisk_r_ms", "The average amount of time in milliseconds that the system takes to respond to read requests to volumes over the sample period.", labelnames, nil),
+	"vdisk_w_mb": "The average number of megabytes transferred per second (MBps) for read and write operations to volumes during the sample period.",
+	"vdisk_w_io": "The average number of I/O operations that are transferred per second for write operations to volumes during the sample period.",
+	"vdisk_w_ms": "The average amount of time in milliseconds that the system takes to respond to write requests to volumes over the sample period.",
 
-		prometheus.NewDesc(prefix_stats+"vdisk_w_mb", "The average number of megabytes transferred per second (MBps) for read and write operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"vdisk_w_io", "The average number of I/O operations that are transferred per second for write operations to volumes during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"vdisk_w_ms", "The average amount of time in milliseconds that the system takes to respond to write requests to volumes over the sample period.", labelnames, nil),
+	"mdisk_r_mb": "The average number of megabytes transferred per second (MBps) for read operations to MDisks during the sample period.",
+	"mdisk_r_io": "The average number of I/O operations that are transferred per second for read operations to MDisks during the sample period.",
+	"mdisk_r_ms": "The average amount of time in milliseconds that the system takes to respond to read requests to MDisks over the sample period.",
 
-		prometheus.NewDesc(prefix_stats+"mdisk_r_mb", "The average number of megabytes transferred per second (MBps) for read operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"mdisk_r_io", "The average number of I/O operations that are transferred per second for read operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"mdisk_r_ms", "The average amount of time in milliseconds that the system takes to respond to read requests to MDisks over the sample period.", labelnames, nil),
+	"mdisk_w_mb": "The average number of megabytes transferred per second (MBps) for write operations to MDisks during the sample period.",
+	"mdisk_w_io": "TThe average number of I/O operations that are transferred per second for write operations to MDisks during the sample period.",
+	"mdisk_w_ms": "the average amount of time in milliseconds that the system takes to respond to write requests to MDisks over the sample period.",
 
-		prometheus.NewDesc(prefix_stats+"mdisk_w_mb", "The average number of megabytes transferred per second (MBps) for write operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"mdisk_w_io", "TThe average number of I/O operations that are transferred per second for write operations to MDisks during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"mdisk_w_ms", "the average amount of time in milliseconds that the system takes to respond to write requests to MDisks over the sample period.", labelnames, nil),
+	"drive_r_mb": "The average number of megabytes transferred per second (MBps) for read operations to drives during the sample period.",
+	"drive_r_io": "The average number of I/O operations that are transferred per second for read operations to drives during the sample period.",
+	"drive_r_ms": "The average amount of time in milliseconds that the system takes to respond to read requests to drives over the sample period.",
 
-		prometheus.NewDesc(prefix_stats+"drive_r_mb", "The average number of megabytes transferred per second (MBps) for read operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"drive_r_io", "The average number of I/O operations that are transferred per second for read operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"drive_r_ms", "The average amount of time in milliseconds that the system takes to respond to read requests to drives over the sample period.", labelnames, nil),
+	"drive_w_mb": "The average number of megabytes transferred per second (MBps) for write operations to drives during the sample period.",
+	"drive_w_io": "The average number of I/O operations that are transferred per second for write operations to drives during the sample period.",
+	"drive_w_ms": "The average amount of time in milliseconds that the system takes to respond write requests to drives over the sample period.",
 
-		prometheus.NewDesc(prefix_stats+"drive_w_mb", "The average number of megabytes transferred per second (MBps) for write operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"drive_w_io", "The average number of I/O operations that are transferred per second for write operations to drives during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"drive_w_ms", "The average amount of time in milliseconds that the system takes to respond write requests to drives over the sample period.", labelnames, nil),
+	"power_w": "the power that is consumed in watts.",
+	"temp_c":  " the ambient temperature in Celsius.",
+	"temp_f":  "the ambient temperature in Fahrenheit.",
 
-		prometheus.NewDesc(prefix_stats+"power_w", "the power that is consumed in watts.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"temp_c", " the ambient temperature in Celsius.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"temp_f", "the ambient temperature in Fahrenheit.", labelnames, nil),
+	"iplink_mb":      "The average number of megabytes requested to be transferred per second (MBps) over the IP partnership link during the sample period. This value is calculated before any compression of the data takes place. This value does not include iSCSI host input/output (I/O) operations.",
+	"iplink_io":      "TThe total input/output (I/O) operations that are transferred per second for IP partnership traffic on the system.",
+	"iplink_comp_mb": "The average number of compressed megabytes transferred per second (MBps) over the IP Replication link during the sample period. This value is calculated after any compression of |the data takes place. This value does not include iSCSI host I/O operations.",
 
-		prometheus.NewDesc(prefix_stats+"iplink_mb", "The average number of megabytes requested to be transferred per second (MBps) over the IP partnership link during the sample period. This value is calculated before any compression of the data takes place. This value does not include iSCSI host input/output (I/O) operations.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"iplink_io", "TThe total input/output (I/O) operations that are transferred per second for IP partnership traffic on the system.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"iplink_comp_mb", "The average number of compressed megabytes transferred per second (MBps) over the IP Replication link during the sample period. This value is calculated after any compression of |the data takes place. This value does not include iSCSI host I/O operations.", labelnames, nil),
+	"cloud_up_mb":   "The average number of megabytes transferred per second (Mbps) for upload operations to a cloud account during the sample period.",
+	"cloud_up_ms":   "The average amount of time (in milliseconds) it takes for the system to respond to upload requests to a cloud account during the sample period.",
+	"cloud_down_mb": "The average number of Mbps for download operations to a cloud account during the sample period.",
+	"cloud_down_ms": "The average amount of time (in milliseconds) it takes for the system to respond to download requests to a cloud account during the sample period.",
 
-		prometheus.NewDesc(prefix_stats+"cloud_up_mb", "The average number of megabytes transferred per second (Mbps) for upload operations to a cloud account during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"cloud_up_ms", "The average amount of time (in milliseconds) it takes for the system to respond to upload requests to a cloud account during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"cloud_down_mb", "The average number of Mbps for download operations to a cloud account during the sample period.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"cloud_down_ms", "The average amount of time (in milliseconds) it takes for the system to respond to download requests to a cloud account during the sample period.", labelnames, nil),
+	"iser_mb": "The total number of megabytes transferred per second (MBps) for iSER traffic on the system.",
+	"iser_io": "The total I/O operations that are transferred per second for iSER traffic on the system.",
+}
 
-		prometheus.NewDesc(prefix_stats+"iser_mb", "The total number of megabytes transferred per second (MBps) for iSER traffic on the system.", labelnames, nil),
-		prometheus.NewDesc(prefix_stats+"iser_io", "The total I/O operations that are transferred per second for iSER traffic on the system.", labelnames, nil),
+type systemStatsCollector struct {
+}
+
+func init() {
+	registerCollector("lssystemstats", defaultEnabled, NewSystemStatsCollector)
+}
+func NewSystemStatsCollector() (Collector, error) {
+	labelnames := []string{"resource"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
+	}
+	systemStats_metrics = make(map[string]*prometheus.Desc)
+	for statName, help := range systemStatsHelp {
+		systemStats_metrics[statName] = prometheus.NewDesc(prefix_stats+statName, help, labelnames, nil)
 	}
+	statLabelnames := append([]string{"resource", "stat"}, utils.ExtraLabelNames...)
+	systemStats_value = prometheus.NewDesc(prefix_stats+"value", "The current value of a system statistic which has no metric of its own, e.g. one added by a firmware upgrade.", statLabelnames, nil)
+	systemStats_peak = prometheus.NewDesc(prefix_stats+"peak", "The peak value of a system statistic over the last 5 minutes.", statLabelnames, nil)
+	systemStats_peak_time = prometheus.NewDesc(prefix_stats+"peak_timestamp_seconds", "Unix time when a system statistic reached its peak value.", statLabelnames, nil)
 
 	return &systemStatsCollector{}, nil
 }
@@ -114,23 +129,26 @@ func NewSystemStatsCollector() (Collector, error) {
 // Describe describes the metrics
 func (*systemStatsCollector) Describe(ch chan<- *prometheus.Desc) {
 
-	for _, metric := range metrics {
+	for _, metric := range systemStats_metrics {
 		ch <- metric
 	}
+	ch <- systemStats_value
+	ch <- systemStats_peak
+	ch <- systemStats_peak_time
 
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *systemStatsCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *systemStatsCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 	logger.Debugln("entering SystemStats collector ...")
-	systemStatsResp, err := sClient.CallSpectrumAPI("lssystemstats", true)
+	systemStatsResp, err := sClient.CallSpectrumAPI(ctx, "lssystemstats", true)
 	if err != nil {
 		logger.Errorf("Executing lssystemstats cmd failed: %s", err.Error())
 		return err
 	}
 	logger.Debugln("response of lssystemstats: ", systemStatsResp)
 	if !gjson.Valid(systemStatsResp) {
-		return fmt.Errorf("invalid json for lscloudcallhome: %v", systemStatsResp)
+		return fmt.Errorf("invalid json for lssystemstats: %v", systemStatsResp)
 	}
 	/* This is a sample output of lssystemstats
 		[
@@ -162,12 +180,27 @@ func (c *systemStatsCollector) Collect(sClient utils.SpectrumClient, ch chan<- p
 	}
 
 	systemStats := gjson.Parse(systemStatsResp).Array()
-	for i, systemStat := range systemStats {
-		// ignore the fields greater than 49
-		if i < 49 {
-			ch <- prometheus.MustNewConstMetric(metrics[i], prometheus.GaugeValue, systemStat.Get("stat_current").Float(), labelvalues...)
+	for _, systemStat := range systemStats {
+		statName := systemStat.Get("stat_name").String()
+		statLabelvalues := append([]string{sClient.Hostname, statName}, utils.ExtraLabelValues...)
+		value := systemStat.Get("stat_current").Float()
+		if metric, ok := systemStats_metrics[statName]; ok {
+			ch <- prometheus.MustNewConstMetric(metric, prometheus.GaugeValue, value, labelvalues...)
+		} else {
+			ch <- prometheus.MustNewConstMetric(systemStats_value, prometheus.GaugeValue, value, statLabelvalues...)
+		}
+		ch <- prometheus.MustNewConstMetric(systemStats_peak, prometheus.GaugeValue, systemStat.Get("stat_peak").Float(), statLabelvalues...)
+		if peakTime, err := parseStatPeakTime(sClient, systemStat.Get("stat_peak_time").String()); err == nil {
+			ch <- prometheus.MustNewConstMetric(systemStats_peak_time, prometheus.GaugeValue, float64(peakTime.Unix()), statLabelvalues...)
+		} else {
+			logger.Debugf("invalid stat_peak_time of %s: %s", statName, err.Error())
 		}
 	}
 	logger.Debugln("exit SystemStats collector")
 	return nil
 }
+
+// parseStatPeakTime parses the stat_peak_time of lssystemstats and lsnodestats, e.g. 181217033223.
+func parseStatPeakTime(sClient utils.SpectrumClient, peakTime string) (time.Time, error) {
+	return sClient.ParseTime("060102150405", peakTime)
+}
@@ -15,6 +15,9 @@
 package collector
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tidwall/gjson"
@@ -23,7 +26,18 @@ import (
 const prefix_volume = "spectrum_volume_"
 
 var (
-	volumeCapacity *prometheus.Desc
+	volumeCapacity        *prometheus.Desc
+	volumeInfo            *prometheus.Desc
+	volumeStatus          *prometheus.Desc
+	volumeCopyCount       *prometheus.Desc
+	volumeFastWriteState  *prometheus.Desc
+	volumeFormatting      *prometheus.Desc
+	volumeEncrypted       *prometheus.Desc
+	volumeThinProvisioned *prometheus.Desc
+	volumeCompressed      *prometheus.Desc
+	volumeDeduplicated    *prometheus.Desc
+	volumeUsedCapacity    *prometheus.Desc
+	volumeRealCapacity    *prometheus.Desc
 )
 
 func init() {
@@ -36,10 +50,23 @@ type volumeCollector struct {
 
 func NewVolumeCollector() (Collector, error) {
 	labelnames := []string{"resource", "volume_id", "volume_name", "mdisk_grp_name"}
+	labelnames_info := []string{"resource", "volume_id", "volume_name", "mdisk_grp_name", "vdisk_uid", "io_group_name", "type"}
 	if len(utils.ExtraLabelNames) > 0 {
 		labelnames = append(labelnames, utils.ExtraLabelNames...)
+		labelnames_info = append(labelnames_info, utils.ExtraLabelNames...)
 	}
 	volumeCapacity = prometheus.NewDesc(prefix_volume+"capacity", "The virtual capacity of the volume that is the size of the volume as seen by the host.", labelnames, nil)
+	volumeInfo = prometheus.NewDesc(prefix_volume+"info", "The unique identifier of the volume as seen by the host, the value is always 1.", labelnames_info, nil)
+	volumeStatus = prometheus.NewDesc(prefix_volume+"status", "The status of the volume. 0-online; 1-offline; 2-degraded.", labelnames, nil)
+	volumeCopyCount = prometheus.NewDesc(prefix_volume+"copy_count", "The number of copies of the volume.", labelnames, nil)
+	volumeFastWriteState = prometheus.NewDesc(prefix_volume+"fast_write_state", "The cache state of the volume. 0-empty; 1-not_empty; 2-corrupt; 3-repairing.", labelnames, nil)
+	volumeFormatting = prometheus.NewDesc(prefix_volume+"formatting", "Indicates whether the volume is being formatted. 0-no; 1-yes.", labelnames, nil)
+	volumeEncrypted = prometheus.NewDesc(prefix_volume+"encrypted", "Indicates whether the volume is encrypted. 0-no; 1-yes.", labelnames, nil)
+	volumeThinProvisioned = prometheus.NewDesc(prefix_volume+"thin_provisioned", "Indicates whether the volume has a thin-provisioned copy. 0-no; 1-yes.", labelnames, nil)
+	volumeCompressed = prometheus.NewDesc(prefix_volume+"compressed", "Indicates whether the volume has a compressed copy. 0-no; 1-yes.", labelnames, nil)
+	volumeDeduplicated = prometheus.NewDesc(prefix_volume+"deduplicated", "Indicates whether the volume has a deduplicated copy. 0-no; 1-yes.", labelnames, nil)
+	volumeUsedCapacity = prometheus.NewDesc(prefix_volume+"used_capacity", "The capacity used by the data of all copies of the volume.", labelnames, nil)
+	volumeRealCapacity = prometheus.NewDesc(prefix_volume+"real_capacity", "The capacity allocated from the storage pools to all copies of the volume.", labelnames, nil)
 
 	return &volumeCollector{}, nil
 }
@@ -48,13 +75,24 @@ func NewVolumeCollector() (Collector, error) {
 func (*volumeCollector) Describe(ch chan<- *prometheus.Desc) {
 
 	ch <- volumeCapacity
+	ch <- volumeInfo
+	ch <- volumeStatus
+	ch <- volumeCopyCount
+	ch <- volumeFastWriteState
+	ch <- volumeFormatting
+	ch <- volumeEncrypted
+	ch <- volumeThinProvisioned
+	ch <- volumeCompressed
+	ch <- volumeDeduplicated
+	ch <- volumeUsedCapacity
+	ch <- volumeRealCapacity
 
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *volumeCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *volumeCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 	logger.Debugln("entering volume collector ...")
-	volumeResp, err := sClient.CallSpectrumAPI("lsvdisk", true)
+	volumeResp, err := sClient.CallSpectrumAPI(ctx, "lsvdisk", true)
 	if err != nil {
 		logger.Errorf("Executing lsvdisk cmd failed: %s", err.Error())
 		return err
@@ -83,6 +121,7 @@ func (c *volumeCollector) Collect(sClient utils.SpectrumClient, ch chan<- promet
 	//         "se_copy_count": "0",
 	//         "RC_change": "no",
 	//         "compressed_copy_count": "0",
+	//         "deduplicated_copy_count": "0",
 	//         "parent_mdisk_grp_id": "0",
 	//         "parent_mdisk_grp_name": "Pool0",
 	//         "formatting": "no",
@@ -92,6 +131,14 @@ func (c *volumeCollector) Collect(sClient utils.SpectrumClient, ch chan<- promet
 	//         "function": ""
 	//     }
 	// ]
+	if !gjson.Valid(volumeResp) {
+		return fmt.Errorf("invalid json for lsvdisk: %v", volumeResp)
+	}
+
+	copyCapacities, err := volumeCopyCapacities(ctx, sClient)
+	if err != nil {
+		return err
+	}
 
 	volumeArray := gjson.Parse(volumeResp).Array()
 	for _, volume := range volumeArray {
@@ -99,12 +146,160 @@ func (c *volumeCollector) Collect(sClient utils.SpectrumClient, ch chan<- promet
 		if err != nil {
 			logger.Errorf("Converting capacity unit failed: %s", err.Error())
 		}
+		volume_id := volume.Get("id").String()
 		labelvalues := []string{sClient.Hostname, volume.Get("volume_id").String(), volume.Get("volume_name").String(), volume.Get("mdisk_grp_name").String()}
+		labelvalues_info := []string{sClient.Hostname, volume.Get("volume_id").String(), volume.Get("volume_name").String(), volume.Get("mdisk_grp_name").String(), volume.Get("vdisk_UID").String(), volume.Get("IO_group_name").String(), volume.Get("type").String()}
 		if len(utils.ExtraLabelValues) > 0 {
 			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+			labelvalues_info = append(labelvalues_info, utils.ExtraLabelValues...)
 		}
 		ch <- prometheus.MustNewConstMetric(volumeCapacity, prometheus.GaugeValue, float64(capacity_bytes), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(volumeInfo, prometheus.GaugeValue, 1, labelvalues_info...)
+
+		v_status := 0
+		switch volume.Get("status").String() {
+		case "online":
+			v_status = 0
+		case "offline":
+			v_status = 1
+		case "degraded":
+			v_status = 2
+		}
+		ch <- prometheus.MustNewConstMetric(volumeStatus, prometheus.GaugeValue, float64(v_status), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(volumeCopyCount, prometheus.GaugeValue, volume.Get("copy_count").Float(), labelvalues...)
+
+		v_fast_write_state := 0
+		switch volume.Get("fast_write_state").String() {
+		case "empty":
+			v_fast_write_state = 0
+		case "not_empty":
+			v_fast_write_state = 1
+		case "corrupt":
+			v_fast_write_state = 2
+		case "repairing":
+			v_fast_write_state = 3
+		}
+		ch <- prometheus.MustNewConstMetric(volumeFastWriteState, prometheus.GaugeValue, float64(v_fast_write_state), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(volumeFormatting, prometheus.GaugeValue, yesNo(volume.Get("formatting").String()), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(volumeEncrypted, prometheus.GaugeValue, yesNo(volume.Get("encrypt").String()), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(volumeThinProvisioned, prometheus.GaugeValue, copyCountFlag(volume.Get("se_copy_count")), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(volumeCompressed, prometheus.GaugeValue, copyCountFlag(volume.Get("compressed_copy_count")), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(volumeDeduplicated, prometheus.GaugeValue, copyCountFlag(volume.Get("deduplicated_copy_count")), labelvalues...)
+
+		ch <- prometheus.MustNewConstMetric(volumeUsedCapacity, prometheus.GaugeValue, float64(copyCapacities[volume_id].used), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(volumeRealCapacity, prometheus.GaugeValue, float64(copyCapacities[volume_id].real), labelvalues...)
 	}
 	logger.Debugln("exit volume collector")
 	return nil
 }
+
+// copyCapacity is the used and real capacity of the copies of a volume.
+type copyCapacity struct {
+	used uint64
+	real uint64
+}
+
+// volumeCopyCapacities returns the used and real capacity summed over the copies of each volume, by the id of the
+// volume. The capacity of a fully allocated copy is used and real, the space-efficient copies, i.e. thin-provisioned
+// or compressed ones, are listed with their used and real capacity by lssevdiskcopy.
+func volumeCopyCapacities(ctx context.Context, sClient utils.SpectrumClient) (map[string]copyCapacity, error) {
+	seCopyResp, err := sClient.CallSpectrumAPI(ctx, "lssevdiskcopy", true)
+	if err != nil {
+		logger.Errorf("Executing lssevdiskcopy cmd failed: %s", err.Error())
+		return nil, err
+	}
+	logger.Debugln("response of lssevdiskcopy: ", seCopyResp)
+	// This is a sample output of lssevdiskcopy
+	// [
+	//     {
+	//         "vdisk_id": "0",
+	//         "vdisk_name": "MGMT1_MGMT1-boot",
+	//         "copy_id": "0",
+	//         "mdisk_grp_id": "0",
+	//         "mdisk_grp_name": "Pool0",
+	//         "capacity": "128.00GB",
+	//         "used_capacity": "23.55GB",
+	//         "real_capacity": "26.12GB",
+	//         "free_capacity": "2.57GB",
+	//         "overallocation": "490",
+	//         "autoexpand": "on",
+	//         "warning": "80",
+	//         "grainsize": "256",
+	//         "se_copy": "yes",
+	//         "compressed_copy": "no",
+	//         "uncompressed_used_capacity": "23.55GB",
+	//         "deduplicated_copy": "no"
+	//     }
+	// ]
+	if !gjson.Valid(seCopyResp) {
+		return nil, fmt.Errorf("invalid json for lssevdiskcopy: %v", seCopyResp)
+	}
+	seCopies := make(map[string]copyCapacity) // by volume id and copy id
+	for _, seCopy := range gjson.Parse(seCopyResp).Array() {
+		used_bytes, err := utils.ToBytes(seCopy.Get("used_capacity").String())
+		if err != nil {
+			logger.Errorf("Converting capacity unit failed: %s", err.Error())
+		}
+		real_bytes, err := utils.ToBytes(seCopy.Get("real_capacity").String())
+		if err != nil {
+			logger.Errorf("Converting capacity unit failed: %s", err.Error())
+		}
+		seCopies[seCopy.Get("vdisk_id").String()+"/"+seCopy.Get("copy_id").String()] = copyCapacity{used: used_bytes, real: real_bytes}
+	}
+
+	volumeCopyResp, err := sClient.CallSpectrumAPI(ctx, "lsvdiskcopy", true)
+	if err != nil {
+		logger.Errorf("Executing lsvdiskcopy cmd failed: %s", err.Error())
+		return nil, err
+	}
+	logger.Debugln("response of lsvdiskcopy: ", volumeCopyResp)
+	// This is a sample output of lsvdiskcopy, shortened
+	// [
+	//     {
+	//         "vdisk_id": "0",
+	//         "vdisk_name": "MGMT1_MGMT1-boot",
+	//         "copy_id": "0",
+	//         ...
+	//         "capacity": "128.00GB",
+	//         "type": "striped",
+	//         "se_copy": "no",
+	//         ...
+	//     }
+	// ]
+	if !gjson.Valid(volumeCopyResp) {
+		return nil, fmt.Errorf("invalid json for lsvdiskcopy: %v", volumeCopyResp)
+	}
+	capacities := make(map[string]copyCapacity)
+	for _, volumeCopy := range gjson.Parse(volumeCopyResp).Array() {
+		vdisk_id := volumeCopy.Get("vdisk_id").String()
+		capacity, ok := seCopies[vdisk_id+"/"+volumeCopy.Get("copy_id").String()]
+		if !ok {
+			capacity_bytes, err := utils.ToBytes(volumeCopy.Get("capacity").String())
+			if err != nil {
+				logger.Errorf("Converting capacity unit failed: %s", err.Error())
+			}
+			capacity = copyCapacity{used: capacity_bytes, real: capacity_bytes}
+		}
+		total := capacities[vdisk_id]
+		total.used += capacity.used
+		total.real += capacity.real
+		capacities[vdisk_id] = total
+	}
+	return capacities, nil
+}
+
+// yesNo returns 1 for yes and 0 otherwise.
+func yesNo(s string) float64 {
+	if s == "yes" {
+		return 1
+	}
+	return 0
+}
+
+// copyCountFlag returns 1 if a count of volume copies is greater than zero and 0 otherwise.
+func copyCountFlag(count gjson.Result) float64 {
+	if count.Int() > 0 {
+		return 1
+	}
+	return 0
+}
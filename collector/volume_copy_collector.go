@@ -15,6 +15,7 @@
 package collector
 
 import (
+	"context"
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tidwall/gjson"
@@ -52,9 +53,9 @@ func (*volumeCopyCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *volumeCopyCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *volumeCopyCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 	logger.Debugln("entering volumeCopy collector ...")
-	volumeCopyResp, err := sClient.CallSpectrumAPI("lsvdiskcopy", true)
+	volumeCopyResp, err := sClient.CallSpectrumAPI(ctx, "lsvdiskcopy", true)
 	if err != nil {
 		logger.Errorf("Executing lsvdiskcopy cmd failed: %s", err.Error())
 		return err
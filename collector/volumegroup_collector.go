@@ -0,0 +1,289 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/IBM/spectrum-virtualize-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	prefix_volumegroup       = "spectrum_volumegroup_"
+	prefix_replicationpolicy = "spectrum_replicationpolicy_"
+)
+
+var (
+	volumegroup_info                       *prometheus.Desc
+	volumegroup_volume_count               *prometheus.Desc
+	replicationpolicy_rpo                  *prometheus.Desc
+	volumegroup_replication_rpo            *prometheus.Desc
+	volumegroup_replication_mode           *prometheus.Desc
+	volumegroup_replication_within_rpo     *prometheus.Desc
+	volumegroup_replication_recovery_point *prometheus.Desc
+	volumegroup_replication_link_status    *prometheus.Desc
+)
+
+// linkStatusKey matches the status of a replication link of lsvolumegroupreplication, e.g. link1_status
+var linkStatusKey = regexp.MustCompile(`^link(\d+)_status$`)
+
+func init() {
+	registerCollector("lsvolumegroup", defaultDisabled, NewVolumeGroupCollector)
+}
+
+// volumeGroupCollector collects volume group and policy-based replication metrics
+type volumeGroupCollector struct {
+}
+
+func NewVolumeGroupCollector() (Collector, error) {
+	labelnames_group := []string{"resource", "volume_group_id", "volume_group_name"}
+	labelnames_info := []string{"resource", "volume_group_id", "volume_group_name", "replication_policy_name", "snapshot_policy_name", "safeguarded_policy_name"}
+	labelnames_policy := []string{"resource", "policy_id", "policy_name", "topology"}
+	labelnames_location := []string{"resource", "volume_group_id", "volume_group_name", "location", "system_name"}
+	labelnames_link := []string{"resource", "volume_group_id", "volume_group_name", "link"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames_group = append(labelnames_group, utils.ExtraLabelNames...)
+		labelnames_info = append(labelnames_info, utils.ExtraLabelNames...)
+		labelnames_policy = append(labelnames_policy, utils.ExtraLabelNames...)
+		labelnames_location = append(labelnames_location, utils.ExtraLabelNames...)
+		labelnames_link = append(labelnames_link, utils.ExtraLabelNames...)
+	}
+	volumegroup_info = prometheus.NewDesc(prefix_volumegroup+"info", "The policies assigned to the volume group, the value is always 1.", labelnames_info, nil)
+	volumegroup_volume_count = prometheus.NewDesc(prefix_volumegroup+"volume_count", "The number of volumes in the volume group.", labelnames_group, nil)
+	replicationpolicy_rpo = prometheus.NewDesc(prefix_replicationpolicy+"rpo_seconds", "The recovery point objective of the replication policy, an alert is raised if the recovery point is older.", labelnames_policy, nil)
+	volumegroup_replication_rpo = prometheus.NewDesc(prefix_volumegroup+"replication_rpo_seconds", "The recovery point objective of the replication policy assigned to the volume group.", labelnames_group, nil)
+	volumegroup_replication_mode = prometheus.NewDesc(prefix_volumegroup+"replication_mode", "The replication mode of the volume group at the location. -1-unknown; 0-production; 1-recovery; 2-independent.", labelnames_location, nil)
+	volumegroup_replication_within_rpo = prometheus.NewDesc(prefix_volumegroup+"replication_within_rpo", "Indicates whether the recovery point of the volume group at the location is within the recovery point objective. 0-no; 1-yes.", labelnames_location, nil)
+	volumegroup_replication_recovery_point = prometheus.NewDesc(prefix_volumegroup+"replication_recovery_point_timestamp_seconds", "The time of the data of the recovery copy of the volume group at the location.", labelnames_location, nil)
+	volumegroup_replication_link_status = prometheus.NewDesc(prefix_volumegroup+"replication_link_status", "Indicates whether the replication link of the volume group is running. 0-not running; 1-running.", labelnames_link, nil)
+	return &volumeGroupCollector{}, nil
+}
+
+// Describe describes the metrics
+func (*volumeGroupCollector) Describe(ch chan<- *prometheus.Desc) {
+
+	ch <- volumegroup_info
+	ch <- volumegroup_volume_count
+	ch <- replicationpolicy_rpo
+	ch <- volumegroup_replication_rpo
+	ch <- volumegroup_replication_mode
+	ch <- volumegroup_replication_within_rpo
+	ch <- volumegroup_replication_recovery_point
+	ch <- volumegroup_replication_link_status
+
+}
+
+// Collect collects metrics from Spectrum Virtualize Restful API
+func (c *volumeGroupCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+	logger.Debugln("entering volumegroup collector ...")
+	volumeGroupResp, err := sClient.CallSpectrumAPI(ctx, "lsvolumegroup", true)
+	if err != nil {
+		logger.Errorf("Executing lsvolumegroup cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lsvolumegroup: ", volumeGroupResp)
+	// This is a sample output of lsvolumegroup
+	// [
+	//     {
+	//         "id": "0",
+	//         "name": "vg0",
+	//         "volume_count": "4",
+	//         "backup_status": "off",
+	//         "last_backup_time": "",
+	//         "owner_id": "",
+	//         "owner_name": "",
+	//         "safeguarded_policy_id": "",
+	//         "safeguarded_policy_name": "",
+	//         "safeguarded_policy_start_time": "",
+	//         "replication_policy_id": "0",
+	//         "replication_policy_name": "rp0",
+	//         "volume_group_type": "",
+	//         "uid": "0",
+	//         "source_volume_group_id": "",
+	//         "source_volume_group_name": "",
+	//         "source_snapshot_id": "",
+	//         "source_snapshot": "",
+	//         "snapshot_policy_id": "0",
+	//         "snapshot_policy_name": "snap_daily",
+	//         "snapshot_policy_suspended": "no"
+	//     }
+	// ]
+	if !gjson.Valid(volumeGroupResp) {
+		return fmt.Errorf("invalid json for lsvolumegroup: %v", volumeGroupResp)
+	}
+	// the replication policy of each volume group, by the id of the volume group
+	groupPolicies := make(map[string]string)
+	for _, group := range gjson.Parse(volumeGroupResp).Array() {
+		group_id := group.Get("id").String()
+		group_name := group.Get("name").String()
+		groupPolicies[group_id] = group.Get("replication_policy_name").String()
+		labelvalues_info := []string{sClient.Hostname, group_id, group_name, group.Get("replication_policy_name").String(), group.Get("snapshot_policy_name").String(), group.Get("safeguarded_policy_name").String()}
+		labelvalues_group := []string{sClient.Hostname, group_id, group_name}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues_info = append(labelvalues_info, utils.ExtraLabelValues...)
+			labelvalues_group = append(labelvalues_group, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(volumegroup_info, prometheus.GaugeValue, 1, labelvalues_info...)
+		ch <- prometheus.MustNewConstMetric(volumegroup_volume_count, prometheus.GaugeValue, group.Get("volume_count").Float(), labelvalues_group...)
+	}
+
+	// code levels without policy-based replication don't know the replication commands
+	replicationPolicyResp, err := sClient.CallSpectrumAPI(ctx, "lsreplicationpolicy", true)
+	if utils.IsUnknownCommand(err) {
+		logger.Debugf("lsreplicationpolicy cmd is unknown, skipping the replication metrics: %s", err.Error())
+		return nil
+	}
+	if err != nil {
+		logger.Errorf("Executing lsreplicationpolicy cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lsreplicationpolicy: ", replicationPolicyResp)
+	// This is a sample output of lsreplicationpolicy
+	// [
+	//     {
+	//         "id": "0",
+	//         "name": "rp0",
+	//         "rpo_alert": "300",
+	//         "topology": "2-site-async-dr",
+	//         "location1_system_name": "cluster1",
+	//         "location1_iogrp_id": "0",
+	//         "location2_system_name": "cluster2",
+	//         "location2_iogrp_id": "0"
+	//     }
+	// ]
+	if !gjson.Valid(replicationPolicyResp) {
+		return fmt.Errorf("invalid json for lsreplicationpolicy: %v", replicationPolicyResp)
+	}
+	// the recovery point objective of each replication policy, by the name of the policy
+	policyRPOs := make(map[string]float64)
+	for _, policy := range gjson.Parse(replicationPolicyResp).Array() {
+		policy_name := policy.Get("name").String()
+		labelvalues := []string{sClient.Hostname, policy.Get("id").String(), policy_name, policy.Get("topology").String()}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		// a high availability policy has no recovery point objective
+		if policy.Get("rpo_alert").String() == "" {
+			continue
+		}
+		policyRPOs[policy_name] = policy.Get("rpo_alert").Float()
+		ch <- prometheus.MustNewConstMetric(replicationpolicy_rpo, prometheus.GaugeValue, policy.Get("rpo_alert").Float(), labelvalues...)
+	}
+
+	replicationResp, err := sClient.CallSpectrumAPI(ctx, "lsvolumegroupreplication", true)
+	if utils.IsUnknownCommand(err) {
+		logger.Debugf("lsvolumegroupreplication cmd is unknown, skipping the replication metrics: %s", err.Error())
+		return nil
+	}
+	if err != nil {
+		logger.Errorf("Executing lsvolumegroupreplication cmd failed: %s", err.Error())
+		return err
+	}
+	logger.Debugln("response of lsvolumegroupreplication: ", replicationResp)
+	// This is a sample output of lsvolumegroupreplication
+	// [
+	//     {
+	//         "id": "0",
+	//         "name": "vg0",
+	//         "replication_policy_id": "0",
+	//         "replication_policy_name": "rp0",
+	//         "local_location": "1",
+	//         "location1_system_name": "cluster1",
+	//         "location1_replication_mode": "production",
+	//         "location1_status": "running",
+	//         "location1_within_rpo": "",
+	//         "location1_recovery_point": "",
+	//         "location2_system_name": "cluster2",
+	//         "location2_replication_mode": "recovery",
+	//         "location2_status": "running",
+	//         "location2_within_rpo": "yes",
+	//         "location2_recovery_point": "240105102955",
+	//         "link1": "cluster2",
+	//         "link1_status": "running"
+	//     }
+	// ]
+	if !gjson.Valid(replicationResp) {
+		return fmt.Errorf("invalid json for lsvolumegroupreplication: %v", replicationResp)
+	}
+	for _, replication := range gjson.Parse(replicationResp).Array() {
+		group_id := replication.Get("id").String()
+		group_name := replication.Get("name").String()
+		if rpo, ok := policyRPOs[groupPolicies[group_id]]; ok {
+			labelvalues := []string{sClient.Hostname, group_id, group_name}
+			if len(utils.ExtraLabelValues) > 0 {
+				labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+			}
+			ch <- prometheus.MustNewConstMetric(volumegroup_replication_rpo, prometheus.GaugeValue, rpo, labelvalues...)
+		}
+		for _, location := range []string{"1", "2"} {
+			system_name := replication.Get("location" + location + "_system_name").String()
+			if system_name == "" {
+				continue
+			}
+			labelvalues := []string{sClient.Hostname, group_id, group_name, location, system_name}
+			if len(utils.ExtraLabelValues) > 0 {
+				labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+			}
+			v_mode := -1
+			switch replication.Get("location" + location + "_replication_mode").String() {
+			case "production":
+				v_mode = 0
+			case "recovery":
+				v_mode = 1
+			case "independent":
+				v_mode = 2
+			}
+			ch <- prometheus.MustNewConstMetric(volumegroup_replication_mode, prometheus.GaugeValue, float64(v_mode), labelvalues...)
+			// only the recovery copy has a recovery point
+			switch replication.Get("location" + location + "_within_rpo").String() {
+			case "yes":
+				ch <- prometheus.MustNewConstMetric(volumegroup_replication_within_rpo, prometheus.GaugeValue, 1, labelvalues...)
+			case "no":
+				ch <- prometheus.MustNewConstMetric(volumegroup_replication_within_rpo, prometheus.GaugeValue, 0, labelvalues...)
+			}
+			if recoveryPoint := replication.Get("location" + location + "_recovery_point").String(); recoveryPoint != "" {
+				t, err := sClient.ParseTime("060102150405", recoveryPoint)
+				if err != nil {
+					logger.Errorf("Parsing recovery point %s failed: %s", recoveryPoint, err.Error())
+				} else {
+					ch <- prometheus.MustNewConstMetric(volumegroup_replication_recovery_point, prometheus.GaugeValue, float64(t.Unix()), labelvalues...)
+				}
+			}
+		}
+		// a volume group has a linkN and linkN_status per partnership it replicates over
+		replication.ForEach(func(key, value gjson.Result) bool {
+			m := linkStatusKey.FindStringSubmatch(key.String())
+			if m == nil || value.String() == "" {
+				return true
+			}
+			labelvalues := []string{sClient.Hostname, group_id, group_name, m[1]}
+			if len(utils.ExtraLabelValues) > 0 {
+				labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+			}
+			v_status := 0
+			if value.String() == "running" {
+				v_status = 1
+			}
+			ch <- prometheus.MustNewConstMetric(volumegroup_replication_link_status, prometheus.GaugeValue, float64(v_status), labelvalues...)
+			return true
+		})
+	}
+	logger.Debugln("exit volumegroup collector")
+	return nil
+}
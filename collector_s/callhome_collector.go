@@ -15,6 +15,7 @@
 package collector_s
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
@@ -50,10 +51,10 @@ func (*callhomeInfoCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *callhomeInfoCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *callhomeInfoCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering Callhome collector ...")
-	respData, err := sClient.CallSpectrumAPI("lscloudcallhome", true)
+	respData, err := sClient.CallSpectrumAPI(ctx, "lscloudcallhome", true)
 	if err != nil {
 		logger.Errorf("executing lscloudcallhome cmd failed: %s", err.Error())
 		return err
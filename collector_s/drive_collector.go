@@ -15,6 +15,7 @@
 package collector_s
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -62,10 +63,10 @@ func (*DriveCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *DriveCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *DriveCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering drive collector ...")
-	respData, err := sClient.CallSpectrumAPI("lsdrive", true)
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsdrive", true)
 	if err != nil {
 		logger.Errorf("executing lsdrive cmd failed: %s", err.Error())
 		return err
@@ -124,7 +125,7 @@ func (c *DriveCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometh
 	v_firmware_consistency := 0
 	base_level := ""
 	for _, drive_id := range drives {
-		resp, err := sClient.CallSpectrumAPI("lsdrive/"+drive_id, true)
+		resp, err := sClient.CallSpectrumAPI(ctx, "lsdrive/"+drive_id, true)
 		if err != nil {
 			logger.Errorf("executing lsdrive/%s cmd failed: %s", drive_id, err.Error())
 			return err
@@ -15,6 +15,7 @@
 package collector_s
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
@@ -51,10 +52,10 @@ func (*enclosureCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *enclosureCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *enclosureCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering enclosure collector ...")
-	respData, err := sClient.CallSpectrumAPI("lsenclosure", true)
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsenclosure", true)
 	if err != nil {
 		logger.Errorf("executing lsenclosure cmd failed: %s", err.Error())
 		return err
@@ -15,6 +15,7 @@
 package collector_s
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
@@ -56,10 +57,10 @@ func (*enclosureBatteryCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *enclosureBatteryCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *enclosureBatteryCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering enclosurebattery collector ...")
-	respData, err := sClient.CallSpectrumAPI("lsenclosurebattery", true)
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsenclosurebattery", true)
 	if err != nil {
 		logger.Errorf("executing lsenclosurebattery cmd failed: %s", err.Error())
 		return err
@@ -15,6 +15,7 @@
 package collector_s
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
@@ -51,10 +52,10 @@ func (*enclosureCanisterCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *enclosureCanisterCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *enclosureCanisterCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering enclosurecanister collector ...")
-	respData, err := sClient.CallSpectrumAPI("lsenclosurecanister", true)
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsenclosurecanister", true)
 	if err != nil {
 		logger.Errorf("executing lsenclosurecanister cmd failed: %s", err.Error())
 		return err
@@ -15,6 +15,7 @@
 package collector_s
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
@@ -51,10 +52,10 @@ func (*enclosurePsuCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *enclosurePsuCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *enclosurePsuCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering enclosurepsu collector ...")
-	respData, err := sClient.CallSpectrumAPI("lsenclosurepsu", true)
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsenclosurepsu", true)
 	if err != nil {
 		logger.Errorf("executing lsenclosurepsu cmd failed: %s", err.Error())
 		return err
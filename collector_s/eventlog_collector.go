@@ -0,0 +1,231 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector_s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/spectrum-virtualize-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+const prefix_eventlog = "spectrum_eventlog_"
+
+var (
+	eventlog_unfixed_events     *prometheus.Desc
+	eventlog_oldest_unfixed_age *prometheus.Desc
+	eventlog_event_info         *prometheus.Desc
+)
+
+func init() {
+	registerCollector("lseventlog", defaultDisabled, NewEventLogCollector)
+}
+
+// eventLogCollector collects the unfixed alerts of the event log
+type eventLogCollector struct {
+	mutex sync.Mutex
+	known map[string]map[string]event // the unfixed alerts of the last collection by sequence number, by target
+}
+
+func NewEventLogCollector() (Collector, error) {
+	labelnames := []string{"resource"}
+	labelnames_count := []string{"resource", "severity", "error_code"}
+	labelnames_info := []string{"resource", "sequence_number", "severity", "error_code", "event_id", "object_type", "object_id", "object_name", "description"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
+		labelnames_count = append(labelnames_count, utils.ExtraLabelNames...)
+		labelnames_info = append(labelnames_info, utils.ExtraLabelNames...)
+	}
+	eventlog_unfixed_events = prometheus.NewDesc(prefix_eventlog+"unfixed_events", "The number of unfixed alerts in the event log by severity and error code.", labelnames_count, nil)
+	eventlog_oldest_unfixed_age = prometheus.NewDesc(prefix_eventlog+"oldest_unfixed_age_seconds", "The time since the oldest unfixed alert in the event log was first logged, 0 if there's none.", labelnames, nil)
+	eventlog_event_info = prometheus.NewDesc(prefix_eventlog+"event_info", "An unfixed alert in the event log, the value is always 1.", labelnames_info, nil)
+	return &eventLogCollector{known: make(map[string]map[string]event)}, nil
+}
+
+// Describe describes the metrics
+func (*eventLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- eventlog_unfixed_events
+	ch <- eventlog_oldest_unfixed_age
+	ch <- eventlog_event_info
+}
+
+// Collect collects metrics from Spectrum Virtualize Restful API
+func (c *eventLogCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+
+	logger.Debugln("entering eventlog collector ...")
+	// the details of the alerts which were unfixed before are known, only the new ones are read
+	c.mutex.Lock()
+	known := c.known[sClient.IpAddress]
+	c.mutex.Unlock()
+	events, err := unfixedAlerts(ctx, sClient, known)
+	if err != nil {
+		return err
+	}
+	unfixed := make(map[string]event)
+	for _, e := range events {
+		unfixed[e.sequence_number] = e
+	}
+	c.mutex.Lock()
+	c.known[sClient.IpAddress] = unfixed
+	c.mutex.Unlock()
+
+	type eventCount struct{ severity, error_code string }
+	counts := make(map[eventCount]int)
+	var oldest time.Time
+	for _, e := range events {
+		labelvalues := []string{sClient.Hostname, e.sequence_number, e.severity, e.error_code, e.event_id, e.object_type, e.object_id, e.object_name, e.description}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(eventlog_event_info, prometheus.GaugeValue, 1, labelvalues...)
+		counts[eventCount{e.severity, e.error_code}]++
+		if !e.first_timestamp.IsZero() && (oldest.IsZero() || e.first_timestamp.Before(oldest)) {
+			oldest = e.first_timestamp
+		}
+	}
+	for count, v := range counts {
+		labelvalues := []string{sClient.Hostname, count.severity, count.error_code}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(eventlog_unfixed_events, prometheus.GaugeValue, float64(v), labelvalues...)
+	}
+	v_oldest := 0.0
+	if !oldest.IsZero() {
+		v_oldest = time.Since(oldest).Seconds()
+	}
+	labelvalues := []string{sClient.Hostname}
+	if len(utils.ExtraLabelValues) > 0 {
+		labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+	}
+	ch <- prometheus.MustNewConstMetric(eventlog_oldest_unfixed_age, prometheus.GaugeValue, v_oldest, labelvalues...)
+
+	logger.Debugln("exit eventlog collector")
+	return nil
+}
+
+// event is an entry of the event log.
+type event struct {
+	sequence_number string
+	error_code      string
+	event_id        string
+	severity        string // error, warning or informational
+	object_type     string
+	object_id       string
+	object_name     string
+	description     string
+	first_timestamp time.Time
+}
+
+// unfixedAlerts returns the unfixed alerts of the event log. The severity and first timestamp of each alert
+// are read from its detailed view, unless the alert is in known. An alert whose details can't be read is skipped.
+func unfixedAlerts(ctx context.Context, sClient utils.SpectrumClient, known map[string]event) ([]event, error) {
+	respData, err := sClient.CallSpectrumAPIWithParams(ctx, "lseventlog", map[string]string{"fixed": "no", "alert": "yes"}, true)
+	if err != nil {
+		logger.Errorf("executing lseventlog cmd failed: %s", err.Error())
+		return nil, err
+	}
+	logger.Debugln("response of lseventlog: ", respData)
+	/* This is a sample output of lseventlog -fixed no -alert yes
+	[
+		{
+			"sequence_number": "120",
+			"last_timestamp": "240302102143",
+			"object_type": "drive",
+			"object_id": "14",
+			"object_name": "",
+			"copy_id": "",
+			"status": "alert",
+			"fixed": "no",
+			"event_id": "010070",
+			"error_code": "1686",
+			"description": "Drive fault type 3"
+		},
+		...
+	] */
+	if !gjson.Valid(respData) {
+		return nil, fmt.Errorf("invalid json for lseventlog:\n%v", respData)
+	}
+	var events []event
+	for _, e := range gjson.Parse(respData).Array() {
+		sequence_number := e.Get("sequence_number").String()
+		if event, ok := known[sequence_number]; ok {
+			events = append(events, event)
+			continue
+		}
+		detailData, err := sClient.CallSpectrumAPI(ctx, "lseventlog/"+sequence_number, true)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			// the alert isn't known, its details are read again next time
+			logger.Errorf("executing lseventlog/%s cmd failed: %s", sequence_number, err.Error())
+			continue
+		}
+		logger.Debugln("response of lseventlog/"+sequence_number+": ", detailData)
+		/* This is a sample output of lseventlog/120
+		{
+			"sequence_number": "120",
+			"first_timestamp": "240301081512",
+			"first_timestamp_epoch": "1709280912",
+			"last_timestamp": "240302102143",
+			"last_timestamp_epoch": "1709374903",
+			"object_type": "drive",
+			"object_id": "14",
+			"object_name": "",
+			"copy_id": "",
+			"reporting_node_id": "1",
+			"reporting_node_name": "node1",
+			"root_sequence_number": "",
+			"event_count": "3",
+			"status": "alert",
+			"fixed": "no",
+			"auto_fixed": "no",
+			"notification_type": "error",
+			"event_id": "010070",
+			"event_id_text": "Drive fault type 3",
+			"error_code": "1686",
+			"error_code_text": "Drive fault type 3",
+			...
+		} */
+		if !gjson.Valid(detailData) {
+			logger.Errorf("invalid json for lseventlog/%s:\n%v", sequence_number, detailData)
+			continue
+		}
+		detail := gjson.Parse(detailData)
+		var first_timestamp time.Time
+		if epoch := detail.Get("first_timestamp_epoch").Int(); epoch > 0 {
+			first_timestamp = time.Unix(epoch, 0)
+		} else if t, err := sClient.ParseTime("060102150405", detail.Get("first_timestamp").String()); err == nil {
+			first_timestamp = t
+		}
+		events = append(events, event{
+			sequence_number: sequence_number,
+			error_code:      e.Get("error_code").String(),
+			event_id:        e.Get("event_id").String(),
+			severity:        detail.Get("notification_type").String(),
+			object_type:     e.Get("object_type").String(),
+			object_id:       e.Get("object_id").String(),
+			object_name:     e.Get("object_name").String(),
+			description:     e.Get("description").String(),
+			first_timestamp: first_timestamp,
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,269 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector_s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/IBM/spectrum-virtualize-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	forwardingMutex sync.Mutex
+	stopForwarding  context.CancelFunc
+	forwarderStates = make(map[string]*forwarderState) // by target, kept across config reloads
+	// metrics about the forwarding of the event log, exposed on every context
+	ForwardedAlerts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spectrum_exporter_eventlog_forwarded_alerts_total",
+		Help: "The number of event log alerts posted to Alertmanager by state, firing or resolved.",
+	}, []string{"state"})
+	ForwardingFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spectrum_exporter_eventlog_forwarding_failures_total",
+		Help: "The number of failed event log forwardings of a target, reading the event log or posting to Alertmanager.",
+	}, []string{"resource"})
+)
+
+// forwarderState is the state of the event log forwarding of a target. It's only kept in memory.
+type forwarderState struct {
+	mutex  sync.Mutex
+	open   map[string]event         // the unfixed alerts posted to Alertmanager, by sequence number
+	posted map[string]postableAlert // the last posted alert of each open alert, by sequence number
+}
+
+// postableAlert is an alert of the Alertmanager API v2.
+type postableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     string            `json:"startsAt,omitempty"`
+	EndsAt       string            `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+}
+
+// StartEventForwarding polls the unfixed alerts of the event log of the targets every interval and posts them to
+// Alertmanager. The alerts which are fixed on the storage device are resolved. A running forwarding is stopped first.
+func StartEventForwarding(targets []utils.Target, config utils.Alertmanager, tokenCaches map[string]*utils.AuthToken, tokenMutexes map[string]*sync.Mutex, colCounters map[string]*utils.Counter, transports map[string]*utils.Transport) error {
+	// creates the SpectrumClients of the targets without running any collector
+	c, err := collectorSet.NewModuleCollector(context.Background(), targets, nil, false, tokenCaches, tokenMutexes, colCounters, transports)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := config.TlsConfig.TlsClientConfig()
+	if err != nil {
+		return err
+	}
+	forwardingMutex.Lock()
+	defer forwardingMutex.Unlock()
+	if stopForwarding != nil {
+		stopForwarding()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopForwarding = cancel
+	ForwardedAlerts.WithLabelValues("firing")
+	ForwardedAlerts.WithLabelValues("resolved")
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+	}
+	states := make(map[string]*forwarderState)
+	for _, t := range targets {
+		state, ok := forwarderStates[t.IpAddress]
+		if !ok {
+			state = &forwarderState{open: make(map[string]event), posted: make(map[string]postableAlert)}
+		}
+		states[t.IpAddress] = state
+		go forwardEvents(ctx, t, c.Client(t), config, client, state)
+	}
+	// the states of the targets which were removed from the config are discarded
+	forwarderStates = states
+	return nil
+}
+
+// StopEventForwarding stops the forwarding of the event log.
+func StopEventForwarding() {
+	forwardingMutex.Lock()
+	defer forwardingMutex.Unlock()
+	if stopForwarding != nil {
+		stopForwarding()
+		stopForwarding = nil
+	}
+}
+
+func forwardEvents(ctx context.Context, host utils.Target, sClient *utils.SpectrumClient, config utils.Alertmanager, client *http.Client, state *forwarderState) {
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		// a forwarding must not overrun the next one
+		pollCtx, cancel := context.WithTimeout(ctx, config.Interval)
+		err := forwardEventsOnce(pollCtx, host, sClient, config, client, state)
+		cancel()
+		if ctx.Err() != nil {
+			// forwarding was stopped
+			return
+		}
+		// the resource is only known after the first login, until then the failures are counted by the IP address
+		resource := sClient.Hostname
+		if resource == "" {
+			resource = host.IpAddress
+		}
+		failures := ForwardingFailures.WithLabelValues(resource)
+		if err != nil {
+			failures.Inc()
+			logger.Errorf("forwarding the event log of %s failed: %s", host.IpAddress, err.Error())
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// forwardEventsOnce posts the unfixed alerts of the event log of a target, the new ones and again the ones posted
+// before so that they don't expire in Alertmanager, and resolves the posted alerts which aren't unfixed anymore.
+func forwardEventsOnce(ctx context.Context, host utils.Target, sClient *utils.SpectrumClient, config utils.Alertmanager, client *http.Client, state *forwarderState) error {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if _, success := sClient.RenewAuthToken(ctx, true); success == 0 {
+		return fmt.Errorf("no valid auth token")
+	}
+	// only the alerts which weren't posted before are new, the details of the others are known
+	events, err := unfixedAlerts(ctx, *sClient, state.open)
+	if err != nil {
+		return err
+	}
+
+	// the extra labels are only read while the alerts are built, not while they are posted
+	utils.ExtraLabelsMutex.RLock()
+	now := time.Now()
+	// firing alerts expire unless they are posted again, like the alerts of Prometheus
+	endsAt := now.Add(4 * config.Interval)
+	var alerts []postableAlert
+	firing := make(map[string]postableAlert)
+	newEvents := 0
+	var resolved []string
+	for _, e := range events {
+		alert := eventAlert(*sClient, e, endsAt)
+		firing[e.sequence_number] = alert
+		posted, ok := state.posted[e.sequence_number]
+		if !ok {
+			newEvents++
+		} else if !maps.Equal(posted.Labels, alert.Labels) {
+			// the extra labels or the resource changed, the alert with the old labels is resolved
+			resolved = append(resolved, e.sequence_number)
+			alerts = append(alerts, resolvedAlert(posted, now))
+		}
+		alerts = append(alerts, alert)
+	}
+	utils.ExtraLabelsMutex.RUnlock()
+	// the fixed alerts are resolved with the labels they were posted with
+	for sequence_number, posted := range state.posted {
+		if _, ok := firing[sequence_number]; !ok {
+			resolved = append(resolved, sequence_number)
+			alerts = append(alerts, resolvedAlert(posted, now))
+		}
+	}
+	if len(alerts) == 0 {
+		return nil
+	}
+	if err := postAlerts(ctx, client, config, alerts); err != nil {
+		return err
+	}
+
+	for _, sequence_number := range resolved {
+		delete(state.open, sequence_number)
+		delete(state.posted, sequence_number)
+	}
+	for _, e := range events {
+		state.open[e.sequence_number] = e
+		state.posted[e.sequence_number] = firing[e.sequence_number]
+	}
+	ForwardedAlerts.WithLabelValues("firing").Add(float64(len(events)))
+	ForwardedAlerts.WithLabelValues("resolved").Add(float64(len(resolved)))
+	logger.Debugf("posted %d unfixed alerts of %s, %d of them new, and resolved %d alerts", len(events), host.IpAddress, newEvents, len(resolved))
+	return nil
+}
+
+// eventAlert returns the Alertmanager alert of an event log alert. An open alert is resolved with the labels it was
+// posted with, otherwise Alertmanager can't match it.
+func eventAlert(sClient utils.SpectrumClient, e event, endsAt time.Time) postableAlert {
+	labels := map[string]string{
+		"alertname":       "SpectrumEventLogAlert",
+		"resource":        sClient.Hostname,
+		"sequence_number": e.sequence_number,
+		"severity":        e.severity,
+		"error_code":      e.error_code,
+		"event_id":        e.event_id,
+		"object_type":     e.object_type,
+		"object_id":       e.object_id,
+		"object_name":     e.object_name,
+	}
+	for i, name := range utils.ExtraLabelNames {
+		labels[name] = utils.ExtraLabelValues[i]
+	}
+	alert := postableAlert{
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary":     fmt.Sprintf("Error code %s on %s %s of %s", e.error_code, e.object_type, e.object_id, sClient.Hostname),
+			"description": e.description,
+		},
+		EndsAt:       endsAt.UTC().Format(time.RFC3339),
+		GeneratorURL: "https://" + sClient.IpAddress + "/",
+	}
+	if !e.first_timestamp.IsZero() {
+		alert.StartsAt = e.first_timestamp.UTC().Format(time.RFC3339)
+	}
+	return alert
+}
+
+// resolvedAlert returns a posted alert which ends at endsAt.
+func resolvedAlert(posted postableAlert, endsAt time.Time) postableAlert {
+	posted.EndsAt = endsAt.UTC().Format(time.RFC3339)
+	return posted
+}
+
+func postAlerts(ctx context.Context, client *http.Client, config utils.Alertmanager, alerts []postableAlert) error {
+	url := config.Url
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	if config.BasicAuth.Username != "" {
+		req.SetBasicAuth(config.BasicAuth.Username, config.BasicAuth.Password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting alerts to %s: %s", url, err.Error())
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("http status code is %v when posting alerts to %s. Body text is: %s", resp.StatusCode, url, string(respBody))
+	}
+	return nil
+}
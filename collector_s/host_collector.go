@@ -15,6 +15,7 @@
 package collector_s
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
@@ -25,9 +26,26 @@ import (
 const prefix_host = "spectrum_host_"
 
 var (
-	host_status *prometheus.Desc
+	host_status           *prometheus.Desc
+	host_ports            *prometheus.Desc
+	host_port_node_logins *prometheus.Desc
+	host_path_redundancy  *prometheus.Desc
 )
 
+// hostLoginsUnlisted are the protocols of the hosts whose logins are neither listed by lshostiplogin nor by lsfabric
+var hostLoginsUnlisted = map[string]bool{
+	"nvme":     true,
+	"fcnvme":   true,
+	"rdmanvme": true,
+}
+
+// hostPortKeys are the keys of the ports in the detailed view of a host, by protocol
+var hostPortKeys = map[string]string{
+	"WWPN":       "fc",
+	"iscsi_name": "iscsi",
+	"nqn":        "nvme",
+}
+
 func init() {
 	registerCollector("lshost", defaultEnabled, NewHostCollector)
 }
@@ -38,23 +56,33 @@ type hostCollector struct {
 
 func NewHostCollector() (Collector, error) {
 	labelnames := []string{"resource", "host_name"}
+	labelnames_ports := []string{"resource", "host_name", "protocol", "state"}
+	labelnames_port := []string{"resource", "host_name", "protocol", "port"}
 	if len(utils.ExtraLabelNames) > 0 {
 		labelnames = append(labelnames, utils.ExtraLabelNames...)
+		labelnames_ports = append(labelnames_ports, utils.ExtraLabelNames...)
+		labelnames_port = append(labelnames_port, utils.ExtraLabelNames...)
 	}
 	host_status = prometheus.NewDesc(prefix_host+"status", "Host connection status. 0-online; 1-offline; 2-degraded.", labelnames, nil)
+	host_ports = prometheus.NewDesc(prefix_host+"ports", "The number of ports of the host by protocol and state. The state is active, inactive (logged in without recent I/O) or offline.", labelnames_ports, nil)
+	host_port_node_logins = prometheus.NewDesc(prefix_host+"port_node_logins", "The number of nodes the port of the host is logged in to.", labelnames_port, nil)
+	host_path_redundancy = prometheus.NewDesc(prefix_host+"path_redundancy", "Indicates whether the host is logged in to more than one node of each I/O group it's logged in to. 0-not redundant; 1-redundant.", labelnames, nil)
 	return &hostCollector{}, nil
 }
 
 // Describe() describes the metrics
 func (*hostCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- host_status
+	ch <- host_ports
+	ch <- host_port_node_logins
+	ch <- host_path_redundancy
 }
 
 // Collect() collects metrics from Spectrum Virtualize Restful API
-func (c *hostCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *hostCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering host collector ...")
-	respData, err := sClient.CallSpectrumAPI("lshost", true)
+	respData, err := sClient.CallSpectrumAPI(ctx, "lshost", true)
 	if err != nil {
 		logger.Errorf("executing lshost cmd failed: %s", err.Error())
 		return err
@@ -81,9 +109,11 @@ func (c *hostCollector) Collect(sClient utils.SpectrumClient, ch chan<- promethe
 	if !gjson.Valid(respData) {
 		return fmt.Errorf("invalid json for lshost:\n%v", respData)
 	}
+	var hosts [][3]string
 	jsonLpars := gjson.Parse(respData)
 	jsonLpars.ForEach(func(key, port gjson.Result) bool {
 		host_name := port.Get("name").String()
+		hosts = append(hosts, [3]string{port.Get("id").String(), host_name, port.Get("protocol").String()})
 		status := port.Get("status").String() // ["online", "offline", "degraded"]
 
 		v_status := 0
@@ -105,6 +135,246 @@ func (c *hostCollector) Collect(sClient utils.SpectrumClient, ch chan<- promethe
 		return true
 	})
 
+	// the ports and logins of the hosts cost three more calls plus one call per host
+	if !collectorConfig("lshost").Logins {
+		logger.Debugln("exit host exit")
+		return nil
+	}
+
+	// the nodes of each I/O group the hosts are logged in to, by host name
+	// lshostiplogin isn't available on older code levels, the path redundancy of the hosts without logins isn't known then
+	logins := make(map[string]map[string]map[string]bool)
+	complete := true
+	ipLogins, err := hostIPLogins(ctx, sClient)
+	if err != nil {
+		logger.Warnf("no IP logins of %s, path redundancy is only reported for the hosts with FC logins: %s", sClient.IpAddress, err.Error())
+		complete = false
+	}
+	fcLogins, err := hostFabricLogins(ctx, sClient)
+	if err != nil {
+		logger.Warnf("no FC logins of %s, path redundancy is only reported for the hosts with IP logins: %s", sClient.IpAddress, err.Error())
+		complete = false
+	}
+	for _, l := range []map[string]map[string]map[string]bool{ipLogins, fcLogins} {
+		for host_name, iogrps := range l {
+			if logins[host_name] == nil {
+				logins[host_name] = make(map[string]map[string]bool)
+			}
+			for iogrp, nodes := range iogrps {
+				if logins[host_name][iogrp] == nil {
+					logins[host_name][iogrp] = make(map[string]bool)
+				}
+				for node := range nodes {
+					logins[host_name][iogrp][node] = true
+				}
+			}
+		}
+	}
+
+	for _, host := range hosts {
+		host_id, host_name, protocol := host[0], host[1], host[2]
+		labelvalues := []string{sClient.Hostname, host_name}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+
+		// a host without logins is not redundant, unless its logins aren't listed by lshostiplogin or lsfabric
+		iogrps, ok := logins[host_name]
+		if ok || (complete && !hostLoginsUnlisted[protocol]) {
+			v_redundancy := 0
+			if ok {
+				v_redundancy = 1
+				for _, nodes := range iogrps {
+					if len(nodes) < 2 {
+						v_redundancy = 0
+					}
+				}
+			}
+			ch <- prometheus.MustNewConstMetric(host_path_redundancy, prometheus.GaugeValue, float64(v_redundancy), labelvalues...)
+		}
+
+		// one call per host, a host which can't be read is skipped
+		resp, err := sClient.CallSpectrumAPI(ctx, "lshost/"+host_id, true)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Errorf("executing lshost/%s cmd failed, skipping host %s: %s", host_id, host_name, err.Error())
+			continue
+		}
+		logger.Debugf("response of lshost/%s: %s", host_id, resp)
+		/* This is a sample output of lshost/<id>, the keys of each port are repeated
+		{
+		    "id": "0",
+		    "name": "DBM1",
+		    "port_count": "2",
+		    "type": "generic",
+		    "mask": "1111111111111111111111111111111111111111111111111111111111111111",
+		    "iogrp_count": "4",
+		    "status": "degraded",
+		    "site_id": "",
+		    "site_name": "",
+		    "host_cluster_id": "",
+		    "host_cluster_name": "",
+		    "protocol": "scsi",
+		    "status_policy": "redundant",
+		    "status_site": "all",
+		    "WWPN": "2100000E1E30E597",
+		    "node_logged_in_count": "2",
+		    "state": "active",
+		    "WWPN": "2100000E1E30E596",
+		    "node_logged_in_count": "0",
+		    "state": "offline",
+		    "owner_id": "",
+		    "owner_name": ""
+		} */
+		if !gjson.Valid(resp) {
+			logger.Errorf("invalid json for lshost/%s, skipping host %s:\n%v", host_id, host_name, resp)
+			continue
+		}
+
+		// the number of ports by protocol and state
+		ports := make(map[string]map[string]int)
+		protocol, port := "", ""
+		gjson.Parse(resp).ForEach(func(key, value gjson.Result) bool {
+			if p, ok := hostPortKeys[key.String()]; ok {
+				protocol, port = p, value.String()
+				if ports[protocol] == nil {
+					ports[protocol] = map[string]int{"active": 0, "inactive": 0, "offline": 0}
+				}
+				return true
+			}
+			if port == "" {
+				return true
+			}
+			switch key.String() {
+			case "node_logged_in_count":
+				labelvalues_port := []string{sClient.Hostname, host_name, protocol, port}
+				if len(utils.ExtraLabelValues) > 0 {
+					labelvalues_port = append(labelvalues_port, utils.ExtraLabelValues...)
+				}
+				ch <- prometheus.MustNewConstMetric(host_port_node_logins, prometheus.GaugeValue, value.Float(), labelvalues_port...)
+			case "state":
+				ports[protocol][value.String()]++
+			}
+			return true
+		})
+		for protocol, states := range ports {
+			for state, count := range states {
+				labelvalues_ports := []string{sClient.Hostname, host_name, protocol, state}
+				if len(utils.ExtraLabelValues) > 0 {
+					labelvalues_ports = append(labelvalues_ports, utils.ExtraLabelValues...)
+				}
+				ch <- prometheus.MustNewConstMetric(host_ports, prometheus.GaugeValue, float64(count), labelvalues_ports...)
+			}
+		}
+	}
+
 	logger.Debugln("exit host exit")
 	return nil
 }
+
+// hostIPLogins returns the nodes of each I/O group the iSCSI and NVMe over TCP hosts are logged in to, by host name.
+func hostIPLogins(ctx context.Context, sClient utils.SpectrumClient) (map[string]map[string]map[string]bool, error) {
+	respData, err := sClient.CallSpectrumAPI(ctx, "lshostiplogin", true)
+	if err != nil {
+		return nil, fmt.Errorf("executing lshostiplogin cmd failed: %s", err.Error())
+	}
+	logger.Debugln("response of lshostiplogin: ", respData)
+	/* This is a sample output of lshostiplogin
+	[
+	    {
+	        "host_id": "1",
+	        "host_name": "iscsi1",
+	        "host_cluster_id": "",
+	        "host_cluster_name": "",
+	        "protocol": "iscsi",
+	        "node_id": "1",
+	        "node_name": "node1",
+	        "IO_group_id": "0",
+	        "IO_group_name": "io_grp0",
+	        "port_id": "3",
+	        "IP_address": "192.168.10.21",
+	        "login_count": "1"
+	    },
+		...
+	] */
+	if !gjson.Valid(respData) {
+		return nil, fmt.Errorf("invalid json for lshostiplogin:\n%v", respData)
+	}
+	logins := make(map[string]map[string]map[string]bool)
+	gjson.Parse(respData).ForEach(func(key, login gjson.Result) bool {
+		host_name := login.Get("host_name").String()
+		iogrp := login.Get("IO_group_id").String()
+		if logins[host_name] == nil {
+			logins[host_name] = make(map[string]map[string]bool)
+		}
+		if logins[host_name][iogrp] == nil {
+			logins[host_name][iogrp] = make(map[string]bool)
+		}
+		logins[host_name][iogrp][login.Get("node_id").String()] = true
+		return true
+	})
+	return logins, nil
+}
+
+// hostFabricLogins returns the nodes of each I/O group the FC hosts are logged in to, by host name.
+func hostFabricLogins(ctx context.Context, sClient utils.SpectrumClient) (map[string]map[string]map[string]bool, error) {
+	// lsfabric tells the node of a login, lsnodecanister its I/O group
+	nodeResp, err := sClient.CallSpectrumAPI(ctx, "lsnodecanister", true)
+	if err != nil {
+		return nil, fmt.Errorf("executing lsnodecanister cmd failed: %s", err.Error())
+	}
+	if !gjson.Valid(nodeResp) {
+		return nil, fmt.Errorf("invalid json for lsnodecanister:\n%v", nodeResp)
+	}
+	iogrps := make(map[string]string)
+	gjson.Parse(nodeResp).ForEach(func(key, node gjson.Result) bool {
+		iogrps[node.Get("id").String()] = node.Get("IO_group_id").String()
+		return true
+	})
+
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsfabric", true)
+	if err != nil {
+		return nil, fmt.Errorf("executing lsfabric cmd failed: %s", err.Error())
+	}
+	logger.Debugln("response of lsfabric: ", respData)
+	/* This is a sample output of lsfabric, the id is the id of the node
+	[
+	    {
+	        "remote_wwpn": "2100000E1E30E597",
+	        "remote_nportid": "010A00",
+	        "id": "1",
+	        "node_name": "node1",
+	        "local_wwpn": "500507680C110009",
+	        "local_port": "1",
+	        "local_nportid": "010B00",
+	        "state": "active",
+	        "name": "DBM1",
+	        "cluster_name": "",
+	        "type": "host"
+	    },
+		...
+	] */
+	if !gjson.Valid(respData) {
+		return nil, fmt.Errorf("invalid json for lsfabric:\n%v", respData)
+	}
+	logins := make(map[string]map[string]map[string]bool)
+	gjson.Parse(respData).ForEach(func(key, login gjson.Result) bool {
+		if login.Get("type").String() != "host" {
+			return true
+		}
+		host_name := login.Get("name").String()
+		node_id := login.Get("id").String()
+		iogrp := iogrps[node_id]
+		if logins[host_name] == nil {
+			logins[host_name] = make(map[string]map[string]bool)
+		}
+		if logins[host_name][iogrp] == nil {
+			logins[host_name][iogrp] = make(map[string]bool)
+		}
+		logins[host_name][iogrp][node_id] = true
+		return true
+	})
+	return logins, nil
+}
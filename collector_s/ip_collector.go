@@ -15,18 +15,24 @@
 package collector_s
 
 import (
-	"fmt"
-	"os/exec"
-	"strings"
+	"context"
+	"sync"
+	"time"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-const prefix_ip = "spectrum_ip_"
+const (
+	prefix_ip = "spectrum_ip_"
+	// ipProbeTimeout is the timeout of each TCP connect and ICMP echo request
+	ipProbeTimeout = 2 * time.Second
+)
 
 var (
-	ip_status *prometheus.Desc
+	ip_status     *prometheus.Desc
+	ip_rtt        *prometheus.Desc
+	ip_probe_info *prometheus.Desc
 )
 
 func init() {
@@ -39,55 +45,84 @@ type ipCollector struct {
 
 func NewIPCollector() (Collector, error) {
 	labelnames := []string{"resource", "ip_name", "ip_address"}
+	labelnames_probe := []string{"resource", "ip_name", "ip_address", "type", "method"}
 	if len(utils.ExtraLabelNames) > 0 {
 		labelnames = append(labelnames, utils.ExtraLabelNames...)
+		labelnames_probe = append(labelnames_probe, utils.ExtraLabelNames...)
 	}
 	ip_status = prometheus.NewDesc(prefix_ip+"status", "IP connection status. 0-connectable; 1-unreachable.", labelnames, nil)
+	ip_rtt = prometheus.NewDesc(prefix_ip+"rtt_seconds", "The round-trip time of the probe which reached the IP address.", labelnames, nil)
+	ip_probe_info = prometheus.NewDesc(prefix_ip+"probe_info", "The type of the IP address and the probe which reached it, the method is none if it's unreachable. The value is always 1.", labelnames_probe, nil)
 	return &ipCollector{}, nil
 }
 
 // Describe() describes the metrics
 func (*ipCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- ip_status
+	ch <- ip_rtt
+	ch <- ip_probe_info
 }
 
 // Collect() collects metrics from Spectrum Virtualize Restful API
-func (c *ipCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *ipCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering IP collector ...")
-	hosts := make(map[string]string)
-	str := sClient.IpAddress[:len(sClient.IpAddress)-1]
-	hosts["PSYS"] = sClient.IpAddress
-	hosts["SSYS"] = str + "1"
-	hosts["SVC1"] = str + "2"
-	hosts["SVC2"] = str + "3"
-
-	for ip_name, ip_address := range hosts {
-		cmd := fmt.Sprintf("ping -c 1 -w 2 %s> /dev/null 2>&1 && echo $? || echo $?", ip_address)
-		respData, err := exec.Command("/bin/sh", "-c", cmd).Output() // #nosec G204
-		if err != nil {
-			logger.Errorf("Ping %s failed: %s", ip_address, err.Error())
-			return err
-		}
-		status := strings.TrimRight(string(respData), "\n")
-		logger.Debugf("Ping %s: %s", ip_address, status)
-
-		v_status := 0
-		switch status {
-		case "0":
-			v_status = 0
-		default:
-			v_status = 1
-		}
-
-		labelvalues := []string{sClient.Hostname, ip_name, ip_address}
-		if len(utils.ExtraLabelValues) > 0 {
-			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
-		}
-
-		ch <- prometheus.MustNewConstMetric(ip_status, prometheus.GaugeValue, float64(v_status), labelvalues...)
+	probeIPs(ctx, sClient, ch)
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
 
 	logger.Debugln("exit IP exit")
 	return nil
 }
+
+// CollectUnauthenticated probes the IP addresses without a login, they're also probed if the REST API is down
+func (c *ipCollector) CollectUnauthenticated(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) {
+	// each probe is bounded by ipProbeTimeout
+	probeIPs(context.Background(), sClient, ch)
+}
+
+// probeIPs probes the management and service IPs of a target concurrently.
+func probeIPs(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) {
+	ips := make(map[string][]utils.NamedIp)
+	ips["management"] = sClient.ManagementIps
+	if len(ips["management"]) == 0 {
+		ips["management"] = []utils.NamedIp{{Name: "PSYS", Address: sClient.IpAddress}}
+	}
+	ips["service"] = sClient.ServiceIps
+	icmp := collectorConfig("ip").Icmp
+
+	var wg sync.WaitGroup
+	for ip_type, namedIps := range ips {
+		for _, ip := range namedIps {
+			wg.Add(1)
+			go func(ip_type string, ip utils.NamedIp) {
+				defer wg.Done()
+				result, err := utils.ProbeAddress(ctx, ip.Address, icmp, ipProbeTimeout)
+				if err != nil {
+					logger.Debugf("Probing %s %s failed: %s", ip.Name, ip.Address, err.Error())
+				}
+				logger.Debugf("Probe %s %s: reachable %t by %s in %s", ip.Name, ip.Address, result.Reachable, result.Method, result.Rtt)
+
+				v_status := 0
+				if !result.Reachable {
+					v_status = 1
+				}
+
+				labelvalues := []string{sClient.Hostname, ip.Name, ip.Address}
+				labelvalues_probe := []string{sClient.Hostname, ip.Name, ip.Address, ip_type, result.Method}
+				if len(utils.ExtraLabelValues) > 0 {
+					labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+					labelvalues_probe = append(labelvalues_probe, utils.ExtraLabelValues...)
+				}
+
+				ch <- prometheus.MustNewConstMetric(ip_status, prometheus.GaugeValue, float64(v_status), labelvalues...)
+				if result.Reachable {
+					ch <- prometheus.MustNewConstMetric(ip_rtt, prometheus.GaugeValue, result.Rtt.Seconds(), labelvalues...)
+				}
+				ch <- prometheus.MustNewConstMetric(ip_probe_info, prometheus.GaugeValue, 1, labelvalues_probe...)
+			}(ip_type, ip)
+		}
+	}
+	wg.Wait()
+}
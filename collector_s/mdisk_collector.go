@@ -15,6 +15,7 @@
 package collector_s
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
@@ -51,10 +52,10 @@ func (*mdiskCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect() collects metrics from Spectrum Virtualize Restful API
-func (c *mdiskCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *mdiskCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering MDisk collector ...")
-	respData, err := sClient.CallSpectrumAPI("lsmdisk", true)
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsmdisk", true)
 	if err != nil {
 		logger.Errorf("executing lsmdisk cmd failed: %s", err.Error())
 		return err
@@ -15,6 +15,7 @@
 package collector_s
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
@@ -52,10 +53,10 @@ func (*mdiskgrpCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect() collects metrics from Spectrum Virtualize Restful API
-func (c *mdiskgrpCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *mdiskgrpCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering MDiskgrp collector ...")
-	respData, err := sClient.CallSpectrumAPI("lsmdiskgrp", true)
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsmdiskgrp", true)
 	if err != nil {
 		logger.Errorf("executing lsmdiskgrp cmd failed: %s", err.Error())
 		return err
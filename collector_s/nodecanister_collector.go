@@ -15,6 +15,7 @@
 package collector_s
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
@@ -51,10 +52,10 @@ func (*nodecanisterCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *nodecanisterCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *nodecanisterCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering nodecanister collector ...")
-	respData, err := sClient.CallSpectrumAPI("lsnodecanister", true)
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsnodecanister", true)
 	if err != nil {
 		logger.Errorf("executing lsnodecanister cmd failed: %s", err.Error())
 		return err
@@ -0,0 +1,368 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector_s
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IBM/spectrum-virtualize-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+const prefix_portethernet = "spectrum_portethernet_"
+
+var (
+	portethernet_link_state      *prometheus.Desc
+	portethernet_speed           *prometheus.Desc
+	portethernet_mtu             *prometheus.Desc
+	portethernet_host_attach     *prometheus.Desc
+	portethernet_failover_active *prometheus.Desc
+	portethernet_info            *prometheus.Desc
+	portethernet_ip_info         *prometheus.Desc
+)
+
+func init() {
+	registerCollector("lsportethernet", defaultDisabled, NewPortEthernetCollector)
+}
+
+// portEthernetCollector collects the setting metrics of the Ethernet ports of the nodes
+type portEthernetCollector struct {
+}
+
+// ethernetPort is an Ethernet port of a node, from lsportethernet or lsportip.
+type ethernetPort struct {
+	node_id          string
+	node_name        string
+	port_id          string
+	mac              string
+	link_state       string
+	speed            string
+	mtu              string
+	adapter_location string
+	adapter_port_id  string
+	host_attach      bool
+	failover_active  *bool        // only known from lsportip
+	ips              []ethernetIP // the IP addresses of the port
+}
+
+// ethernetIP is an IP address of an Ethernet port, from lsip or lsportip.
+type ethernetIP struct {
+	ip_address   string
+	portset_name string // only known from lsip
+	vlan         string
+}
+
+func NewPortEthernetCollector() (Collector, error) {
+	labelnames := []string{"resource", "node_name", "port_id", "mac"}
+	labelnames_info := []string{"resource", "node_name", "port_id", "mac", "adapter_location", "adapter_port_id"}
+	labelnames_ip := []string{"resource", "node_name", "port_id", "ip_address", "portset_name", "vlan"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
+		labelnames_info = append(labelnames_info, utils.ExtraLabelNames...)
+		labelnames_ip = append(labelnames_ip, utils.ExtraLabelNames...)
+	}
+	portethernet_link_state = prometheus.NewDesc(prefix_portethernet+"link_state", "Indicates whether the link of the Ethernet port is active. 0-active; 1-inactive.", labelnames, nil)
+	portethernet_speed = prometheus.NewDesc(prefix_portethernet+"speed_bits_per_second", "The operational speed of the Ethernet port, 0 if the link is inactive.", labelnames, nil)
+	portethernet_mtu = prometheus.NewDesc(prefix_portethernet+"mtu_bytes", "The maximum transmission unit of the Ethernet port.", labelnames, nil)
+	portethernet_host_attach = prometheus.NewDesc(prefix_portethernet+"host_attach", "Indicates whether an IP address of the Ethernet port can be used for host attachment. 0-no; 1-yes.", labelnames, nil)
+	portethernet_failover_active = prometheus.NewDesc(prefix_portethernet+"failover_active", "Indicates whether the IP address of the partner node failed over to the Ethernet port. 0-no; 1-yes.", labelnames, nil)
+	portethernet_info = prometheus.NewDesc(prefix_portethernet+"info", "The adapter of the Ethernet port, the value is always 1.", labelnames_info, nil)
+	portethernet_ip_info = prometheus.NewDesc(prefix_portethernet+"ip_info", "An IP address of the Ethernet port and the portset it's assigned to, the value is always 1.", labelnames_ip, nil)
+	return &portEthernetCollector{}, nil
+}
+
+// Describe describes the metrics
+func (*portEthernetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- portethernet_link_state
+	ch <- portethernet_speed
+	ch <- portethernet_mtu
+	ch <- portethernet_host_attach
+	ch <- portethernet_failover_active
+	ch <- portethernet_info
+	ch <- portethernet_ip_info
+}
+
+// Collect collects metrics from Spectrum Virtualize Restful API
+func (c *portEthernetCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+
+	logger.Debugln("entering portethernet collector ...")
+	var ports []*ethernetPort
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsportethernet", true)
+	switch {
+	case err == nil:
+		ports, err = collectPortEthernet(ctx, sClient, respData)
+	case utils.IsUnknownCommand(err):
+		// lsportethernet, lsip and portsets replaced lsportip in 8.4.2
+		logger.Debugf("lsportethernet cmd is unknown, using lsportip: %s", err.Error())
+		ports, err = collectPortIP(ctx, sClient)
+	default:
+		logger.Errorf("executing lsportethernet cmd failed: %s", err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	selection := collectorConfig("lsportethernet").Ports
+	for _, port := range ports {
+		if !selection.Matches(port.port_id, "", port.adapter_location) {
+			continue
+		}
+		labelvalues := []string{sClient.Hostname, port.node_name, port.port_id, port.mac}
+		labelvalues_info := []string{sClient.Hostname, port.node_name, port.port_id, port.mac, port.adapter_location, port.adapter_port_id}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+			labelvalues_info = append(labelvalues_info, utils.ExtraLabelValues...)
+		}
+		v_link_state := 0
+		if port.link_state != "active" {
+			v_link_state = 1
+		}
+		v_host_attach := 0
+		if port.host_attach {
+			v_host_attach = 1
+		}
+		ch <- prometheus.MustNewConstMetric(portethernet_link_state, prometheus.GaugeValue, float64(v_link_state), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(portethernet_speed, prometheus.GaugeValue, portSpeed(port.speed), labelvalues...)
+		if port.mtu != "" {
+			ch <- prometheus.MustNewConstMetric(portethernet_mtu, prometheus.GaugeValue, gjson.Parse(port.mtu).Float(), labelvalues...)
+		}
+		ch <- prometheus.MustNewConstMetric(portethernet_host_attach, prometheus.GaugeValue, float64(v_host_attach), labelvalues...)
+		if port.failover_active != nil {
+			v_failover_active := 0
+			if *port.failover_active {
+				v_failover_active = 1
+			}
+			ch <- prometheus.MustNewConstMetric(portethernet_failover_active, prometheus.GaugeValue, float64(v_failover_active), labelvalues...)
+		}
+		ch <- prometheus.MustNewConstMetric(portethernet_info, prometheus.GaugeValue, 1, labelvalues_info...)
+		for _, ip := range port.ips {
+			labelvalues_ip := []string{sClient.Hostname, port.node_name, port.port_id, ip.ip_address, ip.portset_name, ip.vlan}
+			if len(utils.ExtraLabelValues) > 0 {
+				labelvalues_ip = append(labelvalues_ip, utils.ExtraLabelValues...)
+			}
+			ch <- prometheus.MustNewConstMetric(portethernet_ip_info, prometheus.GaugeValue, 1, labelvalues_ip...)
+		}
+	}
+
+	logger.Debugln("exit portethernet exit")
+	return nil
+}
+
+// collectPortEthernet returns the ports of lsportethernet with the IP addresses of lsip.
+func collectPortEthernet(ctx context.Context, sClient utils.SpectrumClient, respData string) ([]*ethernetPort, error) {
+	logger.Debugln("response of lsportethernet: ", respData)
+	/* This is a sample output of lsportethernet
+	[
+		{
+			"id": "0",
+			"node_id": "1",
+			"node_name": "node1",
+			"IO_group_id": "0",
+			"IO_group_name": "io_grp0",
+			"port_id": "1",
+			"link_state": "active",
+			"MAC": "08:94:ef:4f:a1:1e",
+			"duplex": "Full",
+			"speed": "25Gb/s",
+			"mtu": "9000",
+			"adapter_location": "1",
+			"adapter_port_id": "1",
+			"is_rdma_capable": "yes",
+			"rdma_type": "RoCE"
+		},
+		...
+	] */
+	if !gjson.Valid(respData) {
+		return nil, fmt.Errorf("invalid json for lsportethernet:\n%v", respData)
+	}
+	var ports []*ethernetPort
+	portsByKey := make(map[string]*ethernetPort)
+	gjson.Parse(respData).ForEach(func(key, port gjson.Result) bool {
+		p := &ethernetPort{
+			node_id:          port.Get("node_id").String(),
+			node_name:        port.Get("node_name").String(),
+			port_id:          port.Get("port_id").String(),
+			mac:              port.Get("MAC").String(),
+			link_state:       port.Get("link_state").String(),
+			speed:            port.Get("speed").String(),
+			mtu:              port.Get("mtu").String(),
+			adapter_location: port.Get("adapter_location").String(),
+			adapter_port_id:  port.Get("adapter_port_id").String(),
+		}
+		ports = append(ports, p)
+		portsByKey[p.node_id+"/"+p.port_id] = p
+		return true
+	})
+
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsportset", true)
+	if err != nil {
+		logger.Errorf("executing lsportset cmd failed: %s", err.Error())
+		return nil, err
+	}
+	logger.Debugln("response of lsportset: ", respData)
+	/* This is a sample output of lsportset
+	[
+		{
+			"id": "0",
+			"name": "portset0",
+			"type": "host",
+			"port_count": "4",
+			"host_count": "2",
+			"lossless": "",
+			"owner_id": "",
+			"owner_name": "",
+			"port_type": "ethernet",
+			"is_default": "yes"
+		},
+		...
+	] */
+	if !gjson.Valid(respData) {
+		return nil, fmt.Errorf("invalid json for lsportset:\n%v", respData)
+	}
+	portsetTypes := make(map[string]string)
+	gjson.Parse(respData).ForEach(func(key, portset gjson.Result) bool {
+		portsetTypes[portset.Get("id").String()] = portset.Get("type").String()
+		return true
+	})
+
+	respData, err = sClient.CallSpectrumAPI(ctx, "lsip", true)
+	if err != nil {
+		logger.Errorf("executing lsip cmd failed: %s", err.Error())
+		return nil, err
+	}
+	logger.Debugln("response of lsip: ", respData)
+	/* This is a sample output of lsip
+	[
+		{
+			"id": "0",
+			"node_id": "1",
+			"node_name": "node1",
+			"port_id": "1",
+			"portset_id": "0",
+			"portset_name": "portset0",
+			"IP_address": "192.168.10.21",
+			"prefix": "24",
+			"vlan": "",
+			"gateway": "192.168.10.1",
+			"owner_id": "",
+			"owner_name": ""
+		},
+		...
+	] */
+	if !gjson.Valid(respData) {
+		return nil, fmt.Errorf("invalid json for lsip:\n%v", respData)
+	}
+	gjson.Parse(respData).ForEach(func(key, ip gjson.Result) bool {
+		p, ok := portsByKey[ip.Get("node_id").String()+"/"+ip.Get("port_id").String()]
+		if !ok {
+			return true
+		}
+		if portsetTypes[ip.Get("portset_id").String()] == "host" {
+			p.host_attach = true
+		}
+		p.ips = append(p.ips, ethernetIP{ip.Get("IP_address").String(), ip.Get("portset_name").String(), ip.Get("vlan").String()})
+		return true
+	})
+	return ports, nil
+}
+
+// collectPortIP returns the ports of lsportip with their IP addresses.
+func collectPortIP(ctx context.Context, sClient utils.SpectrumClient) ([]*ethernetPort, error) {
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsportip", true)
+	if err != nil {
+		logger.Errorf("executing lsportip cmd failed: %s", err.Error())
+		return nil, err
+	}
+	logger.Debugln("response of lsportip: ", respData)
+	/* This is a sample output of lsportip, every port is listed with its own IP addresses (failover no)
+	and with the IP addresses of the partner node it takes over if the partner node fails (failover yes)
+	[
+		{
+			"id": "1",
+			"node_id": "1",
+			"node_name": "node1",
+			"IP_address": "192.168.10.21",
+			"mask": "255.255.255.0",
+			"gateway": "192.168.10.1",
+			"IP_address_6": "",
+			"prefix_6": "",
+			"gateway_6": "",
+			"MAC": "08:94:ef:4f:a1:1e",
+			"duplex": "Full",
+			"state": "configured",
+			"speed": "10Gb/s",
+			"failover": "no",
+			"link_state": "active",
+			"host": "yes",
+			"remote_copy": "0",
+			"host_6": "",
+			"remote_copy_6": "0",
+			"remote_copy_status": "",
+			"remote_copy_status_6": "",
+			"vlan": "",
+			"vlan_6": "",
+			"adapter_location": "1",
+			"adapter_port_id": "1",
+			"lossless_iscsi": "",
+			"lossless_iscsi6": "",
+			"storage": "no",
+			"storage_6": "no",
+			"mtu": "1500"
+		},
+		...
+	] */
+	if !gjson.Valid(respData) {
+		return nil, fmt.Errorf("invalid json for lsportip:\n%v", respData)
+	}
+	var ports []*ethernetPort
+	failovers := make(map[string]bool)
+	gjson.Parse(respData).ForEach(func(key, port gjson.Result) bool {
+		node_id := port.Get("node_id").String()
+		port_id := port.Get("id").String()
+		if port.Get("failover").String() == "yes" {
+			// the IP addresses of the partner node are online on this port after a failover
+			if port.Get("state").String() == "online" {
+				failovers[node_id+"/"+port_id] = true
+			}
+			return true
+		}
+		p := &ethernetPort{
+			node_id:          node_id,
+			node_name:        port.Get("node_name").String(),
+			port_id:          port_id,
+			mac:              port.Get("MAC").String(),
+			link_state:       port.Get("link_state").String(),
+			speed:            port.Get("speed").String(),
+			mtu:              port.Get("mtu").String(),
+			adapter_location: port.Get("adapter_location").String(),
+			adapter_port_id:  port.Get("adapter_port_id").String(),
+			host_attach:      port.Get("host").String() == "yes" || port.Get("host_6").String() == "yes",
+		}
+		ports = append(ports, p)
+		for _, ip := range [][2]string{{port.Get("IP_address").String(), port.Get("vlan").String()}, {port.Get("IP_address_6").String(), port.Get("vlan_6").String()}} {
+			if ip[0] != "" {
+				p.ips = append(p.ips, ethernetIP{ip_address: ip[0], vlan: ip[1]})
+			}
+		}
+		return true
+	})
+	for _, p := range ports {
+		failover_active := failovers[p.node_id+"/"+p.port_id]
+		p.failover_active = &failover_active
+	}
+	return ports, nil
+}
@@ -15,7 +15,10 @@
 package collector_s
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/IBM/spectrum-virtualize-exporter/utils"
 	"github.com/prometheus/client_golang/prometheus"
@@ -25,8 +28,12 @@ import (
 const prefix_portfc = "spectrum_portfc_"
 
 var (
-	portfc_status     *prometheus.Desc
-	portfc_attachment *prometheus.Desc
+	portfc_status                   *prometheus.Desc
+	portfc_attachment               *prometheus.Desc
+	portfc_info                     *prometheus.Desc
+	portfc_speed                    *prometheus.Desc
+	portfc_target_host_io_permitted *prometheus.Desc
+	portfc_target_failed_over       *prometheus.Desc
 )
 
 func init() {
@@ -40,12 +47,20 @@ type portfcCollector struct {
 func NewPortfcCollector() (Collector, error) {
 	labelnames_status := []string{"resource", "node_name", "port_id", "wwpn"}
 	labelnames_attachment := []string{"resource", "node_name", "port_id", "wwpn"}
+	labelnames_info := []string{"resource", "node_name", "port_id", "wwpn", "type", "cluster_use", "adapter_location", "adapter_port_id"}
+	labelnames_target := []string{"resource", "node_name", "port_id", "wwpn", "protocol", "virtualized"}
 	if len(utils.ExtraLabelNames) > 0 {
 		labelnames_status = append(labelnames_status, utils.ExtraLabelNames...)
 		labelnames_attachment = append(labelnames_attachment, utils.ExtraLabelNames...)
+		labelnames_info = append(labelnames_info, utils.ExtraLabelNames...)
+		labelnames_target = append(labelnames_target, utils.ExtraLabelNames...)
 	}
 	portfc_status = prometheus.NewDesc(prefix_portfc+"status", "Indicates whether the port is configured to a device of Fibre Channel (FC) port. 0-active; 1-inactive_configured; 2-inactive_unconfigured.", labelnames_status, nil)
 	portfc_attachment = prometheus.NewDesc(prefix_portfc+"attachment", "Indicates if the port is attached to a FC switch. 0-yes; 1-no.", labelnames_attachment, nil)
+	portfc_info = prometheus.NewDesc(prefix_portfc+"info", "The type, cluster use and adapter of the port, the value is always 1.", labelnames_info, nil)
+	portfc_speed = prometheus.NewDesc(prefix_portfc+"speed_bits_per_second", "The operational speed of the port, 0 if the port is inactive.", labelnames_status, nil)
+	portfc_target_host_io_permitted = prometheus.NewDesc(prefix_portfc+"target_host_io_permitted", "Indicates if host I/O is permitted on the target port. 0-yes; 1-no.", labelnames_target, nil)
+	portfc_target_failed_over = prometheus.NewDesc(prefix_portfc+"target_failed_over", "Indicates if the target port moved to another node than the node that owns it. 0-no; 1-yes.", labelnames_target, nil)
 	return &portfcCollector{}, nil
 }
 
@@ -53,13 +68,17 @@ func NewPortfcCollector() (Collector, error) {
 func (*portfcCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- portfc_status
 	ch <- portfc_attachment
+	ch <- portfc_info
+	ch <- portfc_speed
+	ch <- portfc_target_host_io_permitted
+	ch <- portfc_target_failed_over
 }
 
 // Collect collects metrics from Spectrum Virtualize Restful API
-func (c *portfcCollector) Collect(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+func (c *portfcCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
 
 	logger.Debugln("entering portfc collector ...")
-	respData, err := sClient.CallSpectrumAPI("lsportfc", true)
+	respData, err := sClient.CallSpectrumAPI(ctx, "lsportfc", true)
 	if err != nil {
 		logger.Errorf("executing lsportfc cmd failed: %s", err.Error())
 		return err
@@ -105,12 +124,23 @@ func (c *portfcCollector) Collect(sClient utils.SpectrumClient, ch chan<- promet
 	if !gjson.Valid(respData) {
 		return fmt.Errorf("invalid json for lsportfc:\n%v", respData)
 	}
+	// without a selection all ports except the unused ones are collected, they would raise the port status alert
+	selection := collectorConfig("lsportfc").Ports
+	skipUnconfigured := selection == nil
+	// the selected ports and the names of the nodes, by the id of the node
+	selected := make(map[string]bool)
+	nodeNames := make(map[string]string)
 	jsonPorts := gjson.Parse(respData)
 	jsonPorts.ForEach(func(key, port gjson.Result) bool {
 		port_id := port.Get("port_id").String()
-		if port_id != "1" && port_id != "2" && port_id != "5" && port_id != "6" {
+		nodeNames[port.Get("node_id").String()] = port.Get("node_name").String()
+		if !selection.Matches(port_id, port.Get("cluster_use").String(), port.Get("adapter_location").String()) {
 			return true
 		}
+		if skipUnconfigured && port.Get("status").String() == "inactive_unconfigured" {
+			return true
+		}
+		selected[port.Get("node_id").String()+"/"+port_id] = true
 		node_name := port.Get("node_name").String()
 		wwpn := port.Get("WWPN").String()
 		status := port.Get("status").String() // ["active", "inactive_configured", "inactive_unconfigured"]
@@ -137,9 +167,101 @@ func (c *portfcCollector) Collect(sClient utils.SpectrumClient, ch chan<- promet
 
 		ch <- prometheus.MustNewConstMetric(portfc_status, prometheus.GaugeValue, float64(v_status), labelvalues...)
 		ch <- prometheus.MustNewConstMetric(portfc_attachment, prometheus.GaugeValue, float64(v_attachment), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(portfc_speed, prometheus.GaugeValue, portSpeed(port.Get("port_speed").String()), labelvalues...)
+
+		labelvalues_info := []string{sClient.Hostname, node_name, port_id, wwpn, port.Get("type").String(), port.Get("cluster_use").String(), port.Get("adapter_location").String(), port.Get("adapter_port_id").String()}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues_info = append(labelvalues_info, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(portfc_info, prometheus.GaugeValue, 1, labelvalues_info...)
+		return true
+	})
+
+	// the physical ports are reported without the target ports if lstargetportfc fails
+	respData, err = sClient.CallSpectrumAPI(ctx, "lstargetportfc", true)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		logger.Errorf("executing lstargetportfc cmd failed, skipping the target ports: %s", err.Error())
+		return nil
+	}
+	logger.Debugln("response of lstargetportfc: ", respData)
+	/* This is a sample output of lstargetportfc, the virtualized ports are the NPIV ports the hosts log in to
+	[
+		{
+			"id": "1",
+			"WWPN": "500507681011038D",
+			"WWNN": "500507681000038D",
+			"port_id": "1",
+			"owning_node_id": "1",
+			"current_node_id": "1",
+			"nportid": "010400",
+			"host_io_permitted": "no",
+			"virtualized": "no",
+			"protocol": "scsi"
+		},
+		{
+			"id": "2",
+			"WWPN": "500507681015038D",
+			"WWNN": "500507681000038D",
+			"port_id": "1",
+			"owning_node_id": "1",
+			"current_node_id": "1",
+			"nportid": "010401",
+			"host_io_permitted": "yes",
+			"virtualized": "yes",
+			"protocol": "scsi"
+		},
+		...
+	] */
+	if !gjson.Valid(respData) {
+		logger.Errorf("invalid json for lstargetportfc, skipping the target ports:\n%v", respData)
+		return nil
+	}
+	gjson.Parse(respData).ForEach(func(key, port gjson.Result) bool {
+		port_id := port.Get("port_id").String()
+		owning_node_id := port.Get("owning_node_id").String()
+		// a target port is selected with the physical port of the node owning it
+		if !selected[owning_node_id+"/"+port_id] {
+			return true
+		}
+		v_host_io_permitted := 0
+		if port.Get("host_io_permitted").String() != "yes" {
+			v_host_io_permitted = 1
+		}
+		v_failed_over := 0
+		if port.Get("current_node_id").String() != owning_node_id {
+			v_failed_over = 1
+		}
+		labelvalues := []string{sClient.Hostname, nodeNames[owning_node_id], port_id, port.Get("WWPN").String(), port.Get("protocol").String(), port.Get("virtualized").String()}
+		if len(utils.ExtraLabelValues) > 0 {
+			labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		}
+		ch <- prometheus.MustNewConstMetric(portfc_target_host_io_permitted, prometheus.GaugeValue, float64(v_host_io_permitted), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(portfc_target_failed_over, prometheus.GaugeValue, float64(v_failed_over), labelvalues...)
 		return true
 	})
 
 	logger.Debugln("exit portfc exit")
 	return nil
 }
+
+// portSpeed returns the speed of a port in bits per second, e.g. 16Gb or 25Gb/s, or 0 if it's N/A.
+func portSpeed(s string) float64 {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "/s")
+	unit := 1.0
+	switch {
+	case strings.HasSuffix(s, "Gb"):
+		unit = 1e9
+	case strings.HasSuffix(s, "Mb"):
+		unit = 1e6
+	default:
+		return 0
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSpace(s[:len(s)-2]), 64)
+	if err != nil {
+		return 0
+	}
+	return speed * unit
+}
@@ -0,0 +1,187 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector_s
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/spectrum-virtualize-exporter/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tidwall/gjson"
+)
+
+const prefix_certificate = "spectrum_certificate_"
+
+var (
+	certificate_not_after      *prometheus.Desc
+	certificate_days_to_expiry *prometheus.Desc
+	certificate_key_size       *prometheus.Desc
+	certificate_info           *prometheus.Desc
+)
+
+func init() {
+	registerCollector("lssystemcert", defaultDisabled, NewSystemCertCollector)
+}
+
+// systemCertCollector collects the expiry of the certificate chain of the REST API and of the system certificate
+type systemCertCollector struct {
+}
+
+// certificate is a certificate of the REST API chain or the system certificate.
+type certificate struct {
+	source        string // rest or lssystemcert
+	position      string // position in the chain, 0 is the leaf certificate
+	subject       string
+	issuer        string
+	key_type      string
+	key_size      int
+	serial_number string
+	not_after     time.Time
+}
+
+func NewSystemCertCollector() (Collector, error) {
+	labelnames := []string{"resource", "source", "position", "subject", "issuer"}
+	labelnames_info := []string{"resource", "source", "position", "subject", "issuer", "key_type", "serial_number"}
+	if len(utils.ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, utils.ExtraLabelNames...)
+		labelnames_info = append(labelnames_info, utils.ExtraLabelNames...)
+	}
+	certificate_not_after = prometheus.NewDesc(prefix_certificate+"not_after_timestamp_seconds", "The time the certificate expires, in seconds since the epoch.", labelnames, nil)
+	certificate_days_to_expiry = prometheus.NewDesc(prefix_certificate+"days_to_expiry", "The number of days until the certificate expires, negative if it's expired.", labelnames, nil)
+	certificate_key_size = prometheus.NewDesc(prefix_certificate+"key_size_bits", "The size of the public key of the certificate.", labelnames, nil)
+	certificate_info = prometheus.NewDesc(prefix_certificate+"info", "The key type and serial number of the certificate, the value is always 1.", labelnames_info, nil)
+	return &systemCertCollector{}, nil
+}
+
+// Describe describes the metrics
+func (*systemCertCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- certificate_not_after
+	ch <- certificate_days_to_expiry
+	ch <- certificate_key_size
+	ch <- certificate_info
+}
+
+// Collect collects metrics from Spectrum Virtualize Restful API
+func (c *systemCertCollector) Collect(ctx context.Context, sClient utils.SpectrumClient, ch chan<- prometheus.Metric) error {
+
+	logger.Debugln("entering systemcert collector ...")
+	// lssystemcert is called first, its TLS handshake records the chain even if the certificate is expired
+	respData, certErr := sClient.CallSpectrumAPI(ctx, "lssystemcert", true)
+
+	c.CollectUnauthenticated(sClient, ch)
+
+	if certErr != nil {
+		logger.Errorf("executing lssystemcert cmd failed: %s", certErr.Error())
+		return certErr
+	}
+	logger.Debugln("response of lssystemcert: ", respData)
+	/* This is a sample output of lssystemcert
+	{
+		"certificate_type": "self_signed",
+		"subject_common_name": "FS9500-1",
+		"subject_organization": "IBM",
+		"subject_organizational_unit": "Storage",
+		"issuer_common_name": "FS9500-1 Root CA",
+		"issuer_organization": "IBM",
+		"serial_number": "1A2B3C4D",
+		"key_type": "ecdsa384",
+		"not_before": "Mar  2 10:21:43 2024 GMT",
+		"not_after": "Mar  2 10:21:43 2026 GMT"
+	} */
+	if !gjson.Valid(respData) {
+		return fmt.Errorf("invalid json for lssystemcert:\n%v", respData)
+	}
+	systemCert := gjson.Parse(respData)
+	not_after, err := time.Parse("Jan _2 15:04:05 2006 MST", systemCert.Get("not_after").String())
+	if err != nil {
+		return fmt.Errorf("invalid not_after of lssystemcert: %s", err.Error())
+	}
+	// the key type includes the key size, e.g. rsa2048
+	key_type := strings.TrimRight(systemCert.Get("key_type").String(), "0123456789")
+	key_size, _ := strconv.Atoi(strings.TrimPrefix(systemCert.Get("key_type").String(), key_type))
+	sendCertificate(sClient, ch, certificate{
+		source:        "lssystemcert",
+		position:      "0",
+		subject:       systemCert.Get("subject_common_name").String(),
+		issuer:        systemCert.Get("issuer_common_name").String(),
+		key_type:      key_type,
+		key_size:      key_size,
+		serial_number: systemCert.Get("serial_number").String(),
+		not_after:     not_after,
+	})
+
+	logger.Debugln("exit systemcert collector")
+	return nil
+}
+
+// CollectUnauthenticated collects the certificate chain of the REST API, it's also recorded if the login failed
+func (c *systemCertCollector) CollectUnauthenticated(sClient utils.SpectrumClient, ch chan<- prometheus.Metric) {
+	for i, cert := range sClient.Transport.PeerCertificates() {
+		key_type, key_size := publicKey(cert)
+		sendCertificate(sClient, ch, certificate{
+			source:        "rest",
+			position:      strconv.Itoa(i),
+			subject:       certName(cert.Subject.CommonName, cert.Subject.String()),
+			issuer:        certName(cert.Issuer.CommonName, cert.Issuer.String()),
+			key_type:      key_type,
+			key_size:      key_size,
+			serial_number: fmt.Sprintf("%X", cert.SerialNumber),
+			not_after:     cert.NotAfter,
+		})
+	}
+}
+
+func sendCertificate(sClient utils.SpectrumClient, ch chan<- prometheus.Metric, cert certificate) {
+	labelvalues := []string{sClient.Hostname, cert.source, cert.position, cert.subject, cert.issuer}
+	labelvalues_info := []string{sClient.Hostname, cert.source, cert.position, cert.subject, cert.issuer, cert.key_type, cert.serial_number}
+	if len(utils.ExtraLabelValues) > 0 {
+		labelvalues = append(labelvalues, utils.ExtraLabelValues...)
+		labelvalues_info = append(labelvalues_info, utils.ExtraLabelValues...)
+	}
+	ch <- prometheus.MustNewConstMetric(certificate_not_after, prometheus.GaugeValue, float64(cert.not_after.Unix()), labelvalues...)
+	ch <- prometheus.MustNewConstMetric(certificate_days_to_expiry, prometheus.GaugeValue, time.Until(cert.not_after).Hours()/24, labelvalues...)
+	ch <- prometheus.MustNewConstMetric(certificate_key_size, prometheus.GaugeValue, float64(cert.key_size), labelvalues...)
+	ch <- prometheus.MustNewConstMetric(certificate_info, prometheus.GaugeValue, 1, labelvalues_info...)
+}
+
+// publicKey returns the type and size of the public key of a certificate.
+func publicKey(cert *x509.Certificate) (string, int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "rsa", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ecdsa", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "ed25519", 256
+	default:
+		return strings.ToLower(cert.PublicKeyAlgorithm.String()), 0
+	}
+}
+
+// certName returns the common name of a certificate subject or issuer, or the whole name if it has none.
+func certName(commonName string, name string) string {
+	if commonName != "" {
+		return commonName
+	}
+	return name
+}
@@ -15,12 +15,20 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	metricsCollector "github.com/IBM/spectrum-virtualize-exporter/collector"
@@ -40,18 +48,49 @@ var (
 	configFile             = kingpin.Flag("config.file", "Path to configuration file.").Default("spectrumVirtualize.yml").String()
 	metricsContext         = kingpin.Flag("web.metrics-context", "Context under which to expose metrics.").Default("/metrics").String()
 	settingsContext        = kingpin.Flag("web.settings-context", "Context under which to expose settings.").Default("/settings").String()
+	probeContext           = kingpin.Flag("web.probe-context", "Context under which to probe a target with a module.").Default("/probe").String()
 	listenAddress          = kingpin.Flag("web.listen-address", "Address on which to expose metrics and web interface.").Default(":9119").String()
+	timeoutOffset          = kingpin.Flag("web.timeout-offset", "Offset to subtract from the scrape timeout sent by Prometheus, in seconds.").Default("0.5").Float64()
+	reloadTokenFile        = kingpin.Flag("web.reload-token-file", "File containing the bearer token which authorizes POST /-/reload requests without a client certificate.").String()
 	disableExporterMetrics = kingpin.Flag("web.disable-exporter-metrics", "Exclude metrics about the exporter itself (promhttp_*, process_*, go_*).").Default("true").Bool()
 	// maxRequests            = kingpin.Flag("web.max-requests", "Maximum number of parallel scrape requests. Use 0 to disable.").Default("40").Int()
 	cfg *utils.Config
 	//enableSettingCollectors bool                        = true
-	authTokenCaches  map[string]*utils.AuthToken = make(map[string]*utils.AuthToken)
-	authTokenMutexes map[string]*sync.Mutex      = make(map[string]*sync.Mutex)
-	colCounters      map[string]*utils.Counter   = make(map[string]*utils.Counter)
-	logger           log.Logger                  = *utils.SpectrumLogger()
-	https            bool                        = true
+	logger           log.Logger = *utils.SpectrumLogger()
+	https            bool       = true
+	targetStateMutex sync.Mutex
+	targetStateMap   = make(map[string]*targetState) // by the state key of the target
+	configMutex      sync.RWMutex
+	reloadMutex      sync.Mutex
+	reloadToken      string
+	// metrics about the config reloads, exposed on every context
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "spectrum_exporter_config_last_reload_successful",
+		Help: "Whether the last config reload attempt was successful (1) or not (0).",
+	})
+	configReloadTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "spectrum_exporter_config_last_reload_success_timestamp_seconds",
+		Help: "Unix time of the last successful config load.",
+	})
 )
 
+const (
+	reloadPath = "/-/reload"
+	// the state of a target which is not configured, e.g. a probed one, is discarded after this idle time,
+	// its auth token has expired after 30 inactive minutes anyway
+	stateIdleTimeout = 30 * time.Minute
+)
+
+// targetState is the state of a target shared by all requests of the target.
+type targetState struct {
+	ipAddress      string
+	authToken      *utils.AuthToken
+	authTokenMutex *sync.Mutex
+	counter        *utils.Counter
+	transport      *utils.Transport
+	lastUsed       time.Time
+}
+
 type handler struct {
 	// exporterMetricsRegistry is a separate registry for the metrics about the exporter itself.
 	exporterMetricsRegistry *prometheus.Registry
@@ -70,43 +109,210 @@ func main() {
 
 	//Bail early if the config is bad.
 	logger.Infoln("Loading config from", *configFile)
-	// var err error
-	c, err := utils.GetConfig(*configFile)
+	c, err := loadConfig()
 	if err != nil {
 		logger.Fatalf("Error parsing config file: %s", err.Error())
 		return
 	}
-	cfg = c
-	for _, t := range cfg.Targets {
-		authTokenCaches[t.IpAddress] = &utils.AuthToken{}
-		authTokenMutexes[t.IpAddress] = &sync.Mutex{}
-		colCounters[t.IpAddress] = &utils.Counter{}
-	}
-	for _, l := range cfg.ExtraLabels {
-		utils.ExtraLabelNames = append(utils.ExtraLabelNames, l.Name)
-		utils.ExtraLabelValues = append(utils.ExtraLabelValues, l.Value)
+	if *reloadTokenFile != "" {
+		token, err := os.ReadFile(*reloadTokenFile)
+		if err != nil {
+			logger.Fatalf("Error reading reload token file: %s", err.Error())
+			return
+		}
+		reloadToken = strings.TrimSpace(string(token))
 	}
 	logger.Infoln("Starting Spectrum_Virtualize_exporter", version.Info())
 	logger.Infoln("Build context", version.BuildContext())
 
-	if len(utils.ExtraLabelNames) > 0 {
-		msg := "Extra labels: ["
-		for idx, item := range utils.ExtraLabelNames {
-			msg += "    " + item + " => " + utils.ExtraLabelValues[idx] + ";"
-		}
-		logger.Infoln(msg, "]")
+	if err := applyConfig(c); err != nil {
+		logger.Fatalf("Error applying config: %s", err.Error())
+		return
 	}
+	configReloadSuccess.Set(1)
+	configReloadTimestamp.SetToCurrentTime()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			_ = reloadConfig()
+		}
+	}()
+
 	//Launch http services
 	r.Handle(*metricsContext, newHandler(!*disableExporterMetrics))
 	r.Handle(*settingsContext, newHandler(!*disableExporterMetrics))
+	r.Handle(*probeContext, newHandler(!*disableExporterMetrics))
+	r.HandleFunc(reloadPath, reloadHandler)
 	r.HandleFunc("/", rootFunc)
 
-	if cfg.TlsServerConfig.CaCert != "" && cfg.TlsServerConfig.ServerCert != "" && cfg.TlsServerConfig.ServerKey != "" {
-		startHTTPS(CSRF(r))
+	if c.TlsServerConfig.CaCert != "" && c.TlsServerConfig.ServerCert != "" && c.TlsServerConfig.ServerKey != "" {
+		startHTTPS(skipCSRFForReload(CSRF(r)))
 	} else {
 		https = false
-		startHTTP(CSRF(r))
+		startHTTP(skipCSRFForReload(CSRF(r)))
+	}
+}
+
+// loadConfig reads and validates the config file.
+func loadConfig() (*utils.Config, error) {
+	c, err := utils.GetConfig(*configFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCollectors(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// applyConfig swaps in a validated config. The extra labels, collector settings and polling are
+// replaced, while the states of unchanged targets, e.g. their auth tokens, are kept. The collectors
+// are set up for the new extra labels first, if that fails the old config stays in effect.
+func applyConfig(c *utils.Config) error {
+	var names, values []string
+	for _, l := range c.ExtraLabels {
+		names = append(names, l.Name)
+		values = append(values, l.Value)
+	}
+	// only this function, serialized by the reloads, changes the extra labels
+	if currentConfig() == nil || !slices.Equal(names, utils.ExtraLabelNames) || !slices.Equal(values, utils.ExtraLabelValues) {
+		// wait for the running scrapes, the descriptors of the collectors are created again for new extra labels
+		utils.ExtraLabelsMutex.Lock()
+		oldNames, oldValues := utils.ExtraLabelNames, utils.ExtraLabelValues
+		utils.ExtraLabelNames, utils.ExtraLabelValues = names, values
+		err := setupCollectors()
+		if err != nil && currentConfig() != nil {
+			utils.ExtraLabelNames, utils.ExtraLabelValues = oldNames, oldValues
+			if restoreErr := setupCollectors(); restoreErr != nil {
+				logger.Errorf("couldn't create collectors for the old extra labels: %s", restoreErr.Error())
+			}
+		}
+		utils.ExtraLabelsMutex.Unlock()
+		if err != nil {
+			return fmt.Errorf("couldn't create collectors: %s", err.Error())
+		}
+		if len(names) > 0 {
+			msg := "Extra labels: ["
+			for idx, item := range names {
+				msg += "    " + item + " => " + values[idx] + ";"
+			}
+			logger.Infoln(msg, "]")
+		}
+	}
+	metricsCollector.ConfigureCollectors(c.Collectors)
+	settingsCollector.ConfigureCollectors(c.Collectors)
+
+	configMutex.Lock()
+	cfg = c
+	configMutex.Unlock()
+
+	if c.Polling.Interval > 0 {
+		logger.Infof("Polling metrics of the targets every %s", c.Polling.Interval)
+		tokenCaches, tokenMutexes, counters, targetTransports := targetStates(c.Targets)
+		if err := metricsCollector.StartPolling(c.Targets, c.Polling.Interval, tokenCaches, tokenMutexes, counters, targetTransports); err != nil {
+			return fmt.Errorf("couldn't start polling metrics: %s", err.Error())
+		}
+	} else {
+		metricsCollector.StopPolling()
+	}
+	if c.Polling.SettingsInterval > 0 {
+		logger.Infof("Polling settings of the targets every %s", c.Polling.SettingsInterval)
+		tokenCaches, tokenMutexes, counters, targetTransports := targetStates(c.Targets)
+		if err := settingsCollector.StartPolling(c.Targets, c.Polling.SettingsInterval, tokenCaches, tokenMutexes, counters, targetTransports); err != nil {
+			return fmt.Errorf("couldn't start polling settings: %s", err.Error())
+		}
+	} else {
+		settingsCollector.StopPolling()
+	}
+	if c.Alertmanager.Url != "" {
+		logger.Infof("Forwarding the event logs of the targets to %s every %s", c.Alertmanager.Url, c.Alertmanager.Interval)
+		tokenCaches, tokenMutexes, counters, targetTransports := targetStates(c.Targets)
+		if err := settingsCollector.StartEventForwarding(c.Targets, c.Alertmanager, tokenCaches, tokenMutexes, counters, targetTransports); err != nil {
+			return fmt.Errorf("couldn't start forwarding the event logs: %s", err.Error())
+		}
+	} else {
+		settingsCollector.StopEventForwarding()
+	}
+	return nil
+}
+
+// setupCollectors creates the metrics and setting collectors for the current extra labels.
+func setupCollectors() error {
+	if err := metricsCollector.SetupCollectors(); err != nil {
+		return err
+	}
+	return settingsCollector.SetupCollectors()
+}
+
+// reloadConfig loads the config file again and swaps it in if it's valid.
+func reloadConfig() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	logger.Infoln("Reloading config from", *configFile)
+	c, err := loadConfig()
+	if err == nil {
+		if !reflect.DeepEqual(c.TlsServerConfig, currentConfig().TlsServerConfig) {
+			logger.Warnln("Changes of tls_server_config take effect after a restart")
+		}
+		err = applyConfig(c)
+	}
+	if err != nil {
+		configReloadSuccess.Set(0)
+		logger.Errorf("Error reloading config: %s", err.Error())
+		return err
+	}
+	configReloadSuccess.Set(1)
+	configReloadTimestamp.SetToCurrentTime()
+	logger.Infoln("Reloaded config from", *configFile)
+	return nil
+}
+
+func currentConfig() *utils.Config {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return cfg
+}
+
+// reloadHandler reloads the config on an authorized POST request.
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !reloadAuthorized(r) {
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+	if err := reloadConfig(); err != nil {
+		http.Error(w, fmt.Sprintf("Couldn't reload config: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write([]byte("Config reloaded\n"))
+}
+
+// reloadAuthorized reports whether the client of a reload request presented a verified client
+// certificate (mTLS) or the bearer token of the --web.reload-token-file flag.
+func reloadAuthorized(r *http.Request) bool {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	if reloadToken == "" {
+		return false
 	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+reloadToken)) == 1
+}
+
+// skipCSRFForReload exempts the reload endpoint from the CSRF protection. It's called by tools like
+// curl rather than browsers and authorized by reloadAuthorized instead.
+func skipCSRFForReload(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == reloadPath {
+			r = csrf.UnsafeSkipCheck(r)
+		}
+		handler.ServeHTTP(w, r)
+	})
 }
 
 func startHTTP(handler http.Handler) {
@@ -119,12 +325,15 @@ func startHTTP(handler http.Handler) {
 	}
 	logger.Infof("Listening(HTTP) for %s on %s\n", *metricsContext, *listenAddress)
 	logger.Infof("Listening(HTTP) for %s on %s\n", *settingsContext, *listenAddress)
+	logger.Infof("Listening(HTTP) for %s on %s\n", *probeContext, *listenAddress)
 	logger.Fatal(server.ListenAndServe())
 }
 
 func startHTTPS(handler http.Handler) {
+	// tls_server_config is only read at startup
+	tlsServerConfig := currentConfig().TlsServerConfig
 	// load CA certificate file and add it to list of client CAs
-	caCertFile, err := os.ReadFile(cfg.TlsServerConfig.CaCert)
+	caCertFile, err := os.ReadFile(tlsServerConfig.CaCert)
 	if err != nil {
 		logger.Fatalf("error reading CA certificate: %s", err.Error())
 	}
@@ -162,7 +371,8 @@ func startHTTPS(handler http.Handler) {
 
 	logger.Infof("Listening(HTTPS) for %s on %s\n", *metricsContext, *listenAddress)
 	logger.Infof("Listening(HTTPS) for %s on %s\n", *settingsContext, *listenAddress)
-	logger.Fatal(server.ListenAndServeTLS(cfg.TlsServerConfig.ServerCert, cfg.TlsServerConfig.ServerKey))
+	logger.Infof("Listening(HTTPS) for %s on %s\n", *probeContext, *listenAddress)
+	logger.Fatal(server.ListenAndServeTLS(tlsServerConfig.ServerCert, tlsServerConfig.ServerKey))
 }
 
 func rootFunc(w http.ResponseWriter, r *http.Request) {
@@ -183,11 +393,12 @@ func rootFunc(w http.ResponseWriter, r *http.Request) {
 }
 
 func targetsForRequest(r *http.Request) ([]utils.Target, error) {
+	c := currentConfig()
 	reqTarget := r.URL.Query().Get("target")
 	if reqTarget == "" {
-		return cfg.Targets, nil
+		return c.Targets, nil
 	}
-	for _, t := range cfg.Targets {
+	for _, t := range c.Targets {
 		if t.IpAddress == reqTarget {
 			return []utils.Target{t}, nil
 		}
@@ -195,12 +406,96 @@ func targetsForRequest(r *http.Request) ([]utils.Target, error) {
 	return nil, fmt.Errorf("the target '%s' not defined in the configuration file", reqTarget)
 }
 
+// validateCollectors checks that every collector named in the collectors settings and the modules is
+// registered in either the metrics or the settings collectors.
+func validateCollectors(c *utils.Config) error {
+	for name := range c.Collectors {
+		if !metricsCollector.IsRegistered(name) && !settingsCollector.IsRegistered(name) {
+			return fmt.Errorf("unknown collector '%s' in collectors", name)
+		}
+	}
+	for name, module := range c.Modules {
+		for _, col := range module.Collectors {
+			if !metricsCollector.IsRegistered(col) && !settingsCollector.IsRegistered(col) {
+				return fmt.Errorf("module '%s' refers to unknown collector '%s'", name, col)
+			}
+		}
+	}
+	return nil
+}
+
+// targetStates returns the auth token caches, auth token mutexes, collector counters and HTTP transports
+// of the targets. They are created on the first request of a target and shared by all later requests
+// with the same settings, e.g. a target probed by modules with different credentials has a state per
+// credentials. The states which aren't used anymore are discarded.
+func targetStates(targets []utils.Target) (map[string]*utils.AuthToken, map[string]*sync.Mutex, map[string]*utils.Counter, map[string]*utils.Transport) {
+	targetStateMutex.Lock()
+	defer targetStateMutex.Unlock()
+	tokenCaches := make(map[string]*utils.AuthToken)
+	tokenMutexes := make(map[string]*sync.Mutex)
+	counters := make(map[string]*utils.Counter)
+	targetTransports := make(map[string]*utils.Transport)
+	now := time.Now()
+	for _, t := range targets {
+		key := t.StateKey()
+		state, ok := targetStateMap[key]
+		if !ok {
+			state = &targetState{
+				ipAddress:      t.IpAddress,
+				authToken:      &utils.AuthToken{},
+				authTokenMutex: &sync.Mutex{},
+				counter:        &utils.Counter{},
+				transport:      utils.NewTransport(t),
+			}
+			targetStateMap[key] = state
+		}
+		state.lastUsed = now
+		tokenCaches[t.IpAddress] = state.authToken
+		tokenMutexes[t.IpAddress] = state.authTokenMutex
+		counters[t.IpAddress] = state.counter
+		targetTransports[t.IpAddress] = state.transport
+	}
+	evictTargetStates(now)
+	return tokenCaches, tokenMutexes, counters, targetTransports
+}
+
+// evictTargetStates discards the states of the targets which aren't configured and have been idle,
+// and right away the old states of the configured targets whose settings have changed.
+// targetStateMutex must be held.
+func evictTargetStates(now time.Time) {
+	configured := make(map[string]bool)
+	configuredIps := make(map[string]bool)
+	if c := currentConfig(); c != nil {
+		for _, t := range c.Targets {
+			configured[t.StateKey()] = true
+			configuredIps[t.IpAddress] = true
+		}
+	}
+	for key, state := range targetStateMap {
+		if configured[key] {
+			continue
+		}
+		if configuredIps[state.ipAddress] {
+			logger.Infof("settings of %s changed, discard its auth token and connections", state.ipAddress)
+		} else if now.Sub(state.lastUsed) < stateIdleTimeout {
+			continue
+		} else {
+			logger.Debugf("discard the state of %s, it's been idle since %s", state.ipAddress, state.lastUsed)
+		}
+		// a scrape which still uses the transport opens new connections
+		state.transport.CloseIdleConnections()
+		delete(targetStateMap, key)
+	}
+}
+
 func newHandler(includeExporterMetrics bool) *handler {
 	h := &handler{
 		exporterMetricsRegistry: prometheus.NewRegistry(),
 		includeExporterMetrics:  includeExporterMetrics,
 		// maxRequests:             maxRequests,
 	}
+	h.exporterMetricsRegistry.MustRegister(configReloadSuccess, configReloadTimestamp)
+	h.exporterMetricsRegistry.MustRegister(settingsCollector.ForwardedAlerts, settingsCollector.ForwardingFailures)
 	if h.includeExporterMetrics {
 		h.exporterMetricsRegistry.MustRegister(
 			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
@@ -215,18 +510,33 @@ func newHandler(includeExporterMetrics bool) *handler {
 // ServeHTTP implements http.Handler.
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
+		// the extra labels must not change while the collectors are created and run, a reload
+		// only waits for the running scrapes if it changes the extra labels
+		utils.ExtraLabelsMutex.RLock()
+		defer utils.ExtraLabelsMutex.RUnlock()
 		var handler http.Handler
-		targets, err := targetsForRequest(r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+		var err error
+		ctx, cancel := scrapeContext(r)
+		defer cancel()
+		// match on the path only, RequestURI also carries the query string (e.g. ?target=)
+		switch r.URL.Path {
+		case *metricsContext, *settingsContext:
+			targets, tErr := targetsForRequest(r)
+			if tErr != nil {
+				http.Error(w, tErr.Error(), http.StatusNotFound)
+				return
+			}
+			if r.URL.Path == *metricsContext {
+				handler, err = h.metricsHandler(ctx, targets...)
+			} else {
+				handler, err = h.settingsHandler(ctx, targets...)
+			}
+		case *probeContext:
+			handler, err = h.probeHandler(ctx, r)
+		default:
+			http.Error(w, "404 Not Found", http.StatusNotFound)
 			return
 		}
-		if r.RequestURI == "/metrics" {
-			handler, err = h.metricsHandler(targets...)
-		}
-		if r.RequestURI == "/settings" {
-			handler, err = h.settingsHandler(targets...)
-		}
 
 		if err != nil {
 			logger.Warnln("Couldn't create handler:", err)
@@ -243,14 +553,15 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *handler) metricsHandler(targets ...utils.Target) (http.Handler, error) {
+func (h *handler) metricsHandler(ctx context.Context, targets ...utils.Target) (http.Handler, error) {
 
 	registry := prometheus.NewRegistry()
-	sc, err := metricsCollector.NewSVCCollector(targets, authTokenCaches, authTokenMutexes, colCounters) //new a Spectrum Virtualize Collector
+	tokenCaches, tokenMutexes, counters, targetTransports := targetStates(targets)
+	sc, err := metricsCollector.NewSVCCollector(ctx, targets, tokenCaches, tokenMutexes, counters, targetTransports) //new a Spectrum Virtualize Collector
 	// registry.MustRegister(version.NewCollector("Spectrum-Virtualize-Exporter"))
 
 	if err != nil {
-		logger.Fatalf("Couldn't create metrics collector: %s", err.Error())
+		return nil, fmt.Errorf("couldn't create metrics collector: %s", err.Error())
 	}
 
 	if err := registry.Register(sc); err != nil {
@@ -274,14 +585,15 @@ func (h *handler) metricsHandler(targets ...utils.Target) (http.Handler, error)
 	return handler, nil
 }
 
-func (h *handler) settingsHandler(targets ...utils.Target) (http.Handler, error) {
+func (h *handler) settingsHandler(ctx context.Context, targets ...utils.Target) (http.Handler, error) {
 
 	registry := prometheus.NewRegistry()
-	sc, err := settingsCollector.NewSVCCollector(targets, authTokenCaches, authTokenMutexes, colCounters) //new a Spectrum Virtualize Collector
+	tokenCaches, tokenMutexes, counters, targetTransports := targetStates(targets)
+	sc, err := settingsCollector.NewSVCCollector(ctx, targets, tokenCaches, tokenMutexes, counters, targetTransports) //new a Spectrum Virtualize Collector
 	// registry.MustRegister(version.NewCollector("Spectrum-Virtualize-Exporter"))
 
 	if err != nil {
-		logger.Fatalf("Couldn't create setting collector: %s", err.Error())
+		return nil, fmt.Errorf("couldn't create setting collector: %s", err.Error())
 	}
 
 	if err := registry.Register(sc); err != nil {
@@ -304,3 +616,66 @@ func (h *handler) settingsHandler(targets ...utils.Target) (http.Handler, error)
 	}
 	return handler, nil
 }
+
+// scrapeContext returns the context of a scrape request. It is canceled when the client goes away or,
+// if Prometheus sent its scrape timeout, shortly before Prometheus gives up on the scrape.
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if v == "" {
+		return context.WithCancel(r.Context())
+	}
+	timeoutSeconds, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		logger.Warnf("invalid X-Prometheus-Scrape-Timeout-Seconds header %q: %s", v, err.Error())
+		return context.WithCancel(r.Context())
+	}
+	if *timeoutOffset < timeoutSeconds {
+		timeoutSeconds -= *timeoutOffset
+	}
+	return context.WithTimeout(r.Context(), time.Duration(timeoutSeconds*float64(time.Second)))
+}
+
+// probeHandler scrapes the target of the request with the collectors of the requested module,
+// in the style of the blackbox_exporter: /probe?target=<ip>&module=<name>
+func (h *handler) probeHandler(ctx context.Context, r *http.Request) (http.Handler, error) {
+	reqTarget := r.URL.Query().Get("target")
+	if reqTarget == "" {
+		return nil, fmt.Errorf("the 'target' parameter is missing")
+	}
+	target, module, err := currentConfig().ProbeTarget(reqTarget, r.URL.Query().Get("module"))
+	if err != nil {
+		return nil, err
+	}
+	targets := []utils.Target{target}
+	tokenCaches, tokenMutexes, counters, targetTransports := targetStates(targets)
+
+	registry := prometheus.NewRegistry()
+	mc, err := metricsCollector.NewModuleCollector(ctx, targets, module.Collectors, true, tokenCaches, tokenMutexes, counters, targetTransports)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create metrics collector: %s", err.Error())
+	}
+	if err := registry.Register(mc); err != nil {
+		return nil, fmt.Errorf("couldn't register metrics SVC collector: %s", err.Error())
+	}
+	// both collector sets expose the same scrape metrics, so only the metrics collectors report them
+	sc, err := settingsCollector.NewModuleCollector(ctx, targets, module.Collectors, false, tokenCaches, tokenMutexes, counters, targetTransports)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create setting collector: %s", err.Error())
+	}
+	if err := registry.Register(sc); err != nil {
+		return nil, fmt.Errorf("couldn't register settings SVC collector: %s", err.Error())
+	}
+	handler := promhttp.HandlerFor(
+		prometheus.Gatherers{h.exporterMetricsRegistry, registry},
+		promhttp.HandlerOpts{
+			ErrorLog:      log.NewErrorLogger(),
+			ErrorHandling: promhttp.ContinueOnError,
+		},
+	)
+	if h.includeExporterMetrics {
+		handler = promhttp.InstrumentMetricHandler(
+			h.exporterMetricsRegistry, handler,
+		)
+	}
+	return handler, nil
+}
@@ -0,0 +1,494 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+const selfMetricsPrefix = "spectrum_collector_"
+
+// Collector is the interface a collector has to implement.
+type Collector interface {
+	// Describe metrics
+	Describe(ch chan<- *prometheus.Desc)
+
+	// Collect metrics, the REST calls are canceled when ctx is done
+	Collect(ctx context.Context, client SpectrumClient, ch chan<- prometheus.Metric) error
+}
+
+// UnauthenticatedCollector is implemented by the collectors which also report metrics without a valid auth token.
+type UnauthenticatedCollector interface {
+	// Collect the metrics which don't need the REST API
+	CollectUnauthenticated(client SpectrumClient, ch chan<- prometheus.Metric)
+}
+
+// CollectorSet is a set of registered collectors, e.g. the metrics or the setting collectors. It creates the
+// collectors and the metric descriptors, runs the collectors with their configured intervals and timeouts
+// and collects the targets in the background.
+type CollectorSet struct {
+	kind           string // metrics or setting, used in log messages
+	factories      map[string]func() (Collector, error)
+	collectorState map[string]*bool
+
+	setupMutex                 sync.Mutex
+	setupDone                  bool     // the descriptors and collectors are complete
+	setupLabelNames            []string // the extra labels the descriptors and collectors were created with
+	setupLabelValues           []string // the extra label values of the cached metrics
+	scrapeDurationDesc         *prometheus.Desc
+	authTokenRenewIntervalDesc *prometheus.Desc
+	authTokenRenewSuccessDesc  *prometheus.Desc
+	authTokenRenewFailureDesc  *prometheus.Desc
+	connectionsOpenedDesc      *prometheus.Desc
+	connectionsReusedDesc      *prometheus.Desc
+	snapshotTimestampDesc      *prometheus.Desc
+	snapshotAgeDesc            *prometheus.Desc
+	upDesc                     *prometheus.Desc
+	collectorSuccessDesc       *prometheus.Desc
+	collectorDurationDesc      *prometheus.Desc
+	restRequestsDesc           *prometheus.Desc
+	restDurationDesc           *prometheus.Desc
+	restTokenRenewalsDesc      *prometheus.Desc
+	collectors                 map[string]Collector // collectors enabled by the --collector.[name] flags
+	availableCollectors        map[string]Collector // all registered collectors, used to build modules
+
+	snapshots        *SnapshotCache
+	collectorResults *SnapshotCache // cached results of collectors, keyed by host and collector
+	pollingMutex     sync.Mutex
+	pollingEnabled   bool
+	stopPolling      context.CancelFunc
+	configsMutex     sync.RWMutex
+	configs          map[string]CollectorConfig
+}
+
+// NewCollectorSet creates an empty set of collectors, kind names the collectors in log messages.
+func NewCollectorSet(kind string) *CollectorSet {
+	return &CollectorSet{
+		kind:             kind,
+		factories:        make(map[string]func() (Collector, error)),
+		collectorState:   make(map[string]*bool),
+		snapshots:        NewSnapshotCache(),
+		collectorResults: NewSnapshotCache(),
+		configs:          make(map[string]CollectorConfig),
+	}
+}
+
+// Register registers a collector and its --collector.[name] flag.
+func (s *CollectorSet) Register(collector string, isDefaultEnabled bool, factory func() (Collector, error)) {
+	var helpDefaultState string
+	if isDefaultEnabled {
+		helpDefaultState = "enabled"
+	} else {
+		helpDefaultState = "disabled"
+	}
+
+	flagName := fmt.Sprintf("collector.%s", collector)
+	flagHelp := fmt.Sprintf("enable the %s collector (default: %s)", collector, helpDefaultState)
+	defaultValue := fmt.Sprintf("%v", isDefaultEnabled)
+
+	flag := kingpin.Flag(flagName, flagHelp).Default(defaultValue).Bool()
+	s.collectorState[collector] = flag
+
+	s.factories[collector] = factory
+}
+
+// IsRegistered reports whether a collector with the given name is registered in the set.
+func (s *CollectorSet) IsRegistered(name string) bool {
+	_, ok := s.factories[name]
+	return ok
+}
+
+// Setup creates the metric descriptors and the collectors. They are created again when the
+// extra labels have changed, which requires holding ExtraLabelsMutex for writing. The cached
+// metrics are discarded when the names or values of the extra labels have changed.
+func (s *CollectorSet) Setup() error {
+	s.setupMutex.Lock()
+	defer s.setupMutex.Unlock()
+	if s.setupDone && slices.Equal(s.setupLabelNames, ExtraLabelNames) {
+		if !slices.Equal(s.setupLabelValues, ExtraLabelValues) {
+			// the cached metrics carry the old extra label values
+			s.snapshots.Clear()
+			s.collectorResults.Clear()
+			s.setupLabelValues = slices.Clone(ExtraLabelValues)
+		}
+		return nil
+	}
+	// the collectors overwrite their descriptors, a failed setup has to be repeated
+	s.setupDone = false
+	labelnames := []string{"resource"}
+	if len(ExtraLabelNames) > 0 {
+		labelnames = append(labelnames, ExtraLabelNames...)
+	}
+	// metric name, help information, Array of defined label names, defined labels
+	s.scrapeDurationDesc = prometheus.NewDesc(selfMetricsPrefix+"scrape_duration_seconds", "Duration of a collector scraping for one host", labelnames, nil)
+	s.authTokenRenewIntervalDesc = prometheus.NewDesc(selfMetricsPrefix+"authtoken_renew_interval_seconds", "Interval of the last renewing auth token", labelnames, nil)
+	s.authTokenRenewSuccessDesc = prometheus.NewDesc(selfMetricsPrefix+"authtoken_renew_success_total", "Cumulative count of successful verification of renewed auth token", labelnames, nil)
+	s.authTokenRenewFailureDesc = prometheus.NewDesc(selfMetricsPrefix+"authtoken_renew_failure_total", "Cumulative count of failed verification of renewed auth token", labelnames, nil)
+	s.connectionsOpenedDesc = prometheus.NewDesc(selfMetricsPrefix+"http_connections_opened_total", "Cumulative count of new connections opened to the REST API of a host", labelnames, nil)
+	s.connectionsReusedDesc = prometheus.NewDesc(selfMetricsPrefix+"http_connections_reused_total", "Cumulative count of REST API calls which reused an idle connection to a host", labelnames, nil)
+	s.snapshotTimestampDesc = prometheus.NewDesc(selfMetricsPrefix+"snapshot_timestamp_seconds", "Unix time when the served snapshot of a host was collected in the background", labelnames, nil)
+	s.snapshotAgeDesc = prometheus.NewDesc(selfMetricsPrefix+"snapshot_age_seconds", "Age of the served snapshot of a host collected in the background", labelnames, nil)
+	s.upDesc = prometheus.NewDesc("spectrum_up", "Whether the REST API of a host could be logged in to (1) or not (0)", labelnames, nil)
+	collectorLabelnames := append([]string{"resource", "collector"}, ExtraLabelNames...)
+	s.collectorSuccessDesc = prometheus.NewDesc("spectrum_scrape_collector_success", "Whether a collector succeeded (1) or failed (0) for one host", collectorLabelnames, nil)
+	s.collectorDurationDesc = prometheus.NewDesc("spectrum_scrape_collector_duration_seconds", "Duration of a collector scraping for one host", collectorLabelnames, nil)
+	restLabelnames := append([]string{"resource", "command", "status_class"}, ExtraLabelNames...)
+	s.restRequestsDesc = prometheus.NewDesc(selfMetricsPrefix+"rest_requests_total", "Cumulative count of REST API calls to a host by command and HTTP status class", restLabelnames, nil)
+	s.restDurationDesc = prometheus.NewDesc(selfMetricsPrefix+"rest_request_duration_seconds", "Latency of REST API calls to a host by command and HTTP status class", restLabelnames, nil)
+	s.restTokenRenewalsDesc = prometheus.NewDesc(selfMetricsPrefix+"rest_token_renewals_total", "Cumulative count of auth token renewals triggered by REST API calls rejected with 401 or 403", labelnames, nil)
+
+	enabledCollectors := make(map[string]Collector)
+	allCollectors := make(map[string]Collector)
+	logger.Infof("enabled %s collectors:", s.kind)
+	for key, factory := range s.factories {
+		collector, err := factory()
+		if err != nil {
+			logger.Errorf("failed to load %s collector: %s", s.kind, key)
+			return err
+		}
+		allCollectors[key] = collector
+		if *s.collectorState[key] {
+			enabledCollectors[key] = collector
+			logger.Infof(" - %s", key)
+		}
+	}
+	s.collectors = enabledCollectors
+	s.availableCollectors = allCollectors
+	// the cached metrics carry the old extra labels
+	s.snapshots.Clear()
+	s.collectorResults.Clear()
+	s.setupLabelNames = slices.Clone(ExtraLabelNames)
+	s.setupLabelValues = slices.Clone(ExtraLabelValues)
+	s.setupDone = true
+	return nil
+}
+
+// Configure sets the refresh intervals and timeouts of the collectors.
+// Names which are not registered in the set are ignored.
+func (s *CollectorSet) Configure(configs map[string]CollectorConfig) {
+	s.configsMutex.Lock()
+	defer s.configsMutex.Unlock()
+	s.configs = make(map[string]CollectorConfig)
+	for name, config := range configs {
+		if s.IsRegistered(name) {
+			s.configs[name] = config
+		}
+	}
+}
+
+// Config returns the configuration of a collector.
+func (s *CollectorSet) Config(name string) CollectorConfig {
+	s.configsMutex.RLock()
+	defer s.configsMutex.RUnlock()
+	return s.configs[name]
+}
+
+// NewSVCCollector creates a new Spectrum Virtualize Collector for the given targets which runs the
+// collectors enabled by the --collector.[name] flags, or serves the latest background snapshots while
+// polling. Outstanding REST calls are canceled when ctx is done.
+func (s *CollectorSet) NewSVCCollector(ctx context.Context, targets []Target, tokenCaches map[string]*AuthToken, tokenMutexes map[string]*sync.Mutex, colCounters map[string]*Counter, transports map[string]*Transport) (*SVCCollector, error) {
+	if err := s.Setup(); err != nil {
+		return nil, err
+	}
+	c := s.newSVCCollector(ctx, targets, s.collectors, true, tokenCaches, tokenMutexes, colCounters, transports)
+	s.pollingMutex.Lock()
+	c.useSnapshots = s.pollingEnabled
+	s.pollingMutex.Unlock()
+	return c, nil
+}
+
+// NewModuleCollector creates a new Spectrum Virtualize Collector for the given targets which runs
+// only the named collectors, regardless of the --collector.[name] flags. Names which are not
+// registered in the set are ignored. The scrape duration and auth token metrics are only
+// exposed when selfMetrics is true. Outstanding REST calls are canceled when ctx is done.
+func (s *CollectorSet) NewModuleCollector(ctx context.Context, targets []Target, names []string, selfMetrics bool, tokenCaches map[string]*AuthToken, tokenMutexes map[string]*sync.Mutex, colCounters map[string]*Counter, transports map[string]*Transport) (*SVCCollector, error) {
+	if err := s.Setup(); err != nil {
+		return nil, err
+	}
+	moduleCollectors := make(map[string]Collector)
+	for _, name := range names {
+		if col, ok := s.availableCollectors[name]; ok {
+			moduleCollectors[name] = col
+		}
+	}
+	return s.newSVCCollector(ctx, targets, moduleCollectors, selfMetrics, tokenCaches, tokenMutexes, colCounters, transports), nil
+}
+
+// StartPolling collects the targets with the enabled collectors in the background every interval.
+// Afterwards the collectors created by NewSVCCollector serve the latest snapshot of a target
+// instead of calling the REST API on every scrape. A running background collection is stopped first.
+func (s *CollectorSet) StartPolling(targets []Target, interval time.Duration, tokenCaches map[string]*AuthToken, tokenMutexes map[string]*sync.Mutex, colCounters map[string]*Counter, transports map[string]*Transport) error {
+	if err := s.Setup(); err != nil {
+		return err
+	}
+	s.pollingMutex.Lock()
+	defer s.pollingMutex.Unlock()
+	if s.stopPolling != nil {
+		s.stopPolling()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := s.newSVCCollector(ctx, targets, s.collectors, true, tokenCaches, tokenMutexes, colCounters, transports)
+	s.stopPolling = cancel
+	s.pollingEnabled = true
+	for _, t := range targets {
+		go c.poll(t, interval)
+	}
+	return nil
+}
+
+// StopPolling stops the background collection. Afterwards the targets are scraped on every request again.
+func (s *CollectorSet) StopPolling() {
+	s.pollingMutex.Lock()
+	defer s.pollingMutex.Unlock()
+	if s.stopPolling != nil {
+		s.stopPolling()
+		s.stopPolling = nil
+	}
+	s.pollingEnabled = false
+}
+
+// newSVCCollector creates the SpectrumClients of the targets from their shared states.
+func (s *CollectorSet) newSVCCollector(ctx context.Context, targets []Target, cols map[string]Collector, selfMetrics bool, tokenCaches map[string]*AuthToken, tokenMutexes map[string]*sync.Mutex, colCounters map[string]*Counter, transports map[string]*Transport) *SVCCollector {
+	clients := make(map[string]*SpectrumClient)
+	for _, t := range targets {
+		tokenMutexes[t.IpAddress].Lock()
+		// the hostname and time zone are known after the first successful login of any client of the target
+		hostname, timeZone := tokenCaches[t.IpAddress].Hostname, tokenCaches[t.IpAddress].TimeZone
+		tokenMutexes[t.IpAddress].Unlock()
+		clients[t.IpAddress] = &SpectrumClient{
+			UserName:       t.Userid,
+			Password:       t.Password,
+			IpAddress:      t.IpAddress,
+			Hostname:       hostname,
+			AuthTokenCache: tokenCaches[t.IpAddress],
+			AuthTokenMutex: tokenMutexes[t.IpAddress],
+			ColCounter:     colCounters[t.IpAddress],
+			Transport:      transports[t.IpAddress],
+			ManagementIps:  t.ManagementIps,
+			ServiceIps:     t.ServiceIps,
+			TimeZone:       timeZone,
+		}
+	}
+	return &SVCCollector{set: s, targets: targets, clients: clients, collectors: cols, selfMetrics: selfMetrics, ctx: ctx}
+}
+
+// SVCCollector implements the prometheus.Collector interface
+type SVCCollector struct {
+	set *CollectorSet
+	// targets are the hosts scraped by this collector, selected per request
+	targets     []Target
+	clients     map[string]*SpectrumClient // by IP address of the target
+	collectors  map[string]Collector
+	selfMetrics bool
+	// useSnapshots serves the latest background snapshot of a target instead of scraping it
+	useSnapshots bool
+	// ctx bounds the REST calls of a scrape, usually the context of the HTTP request
+	ctx context.Context
+}
+
+// Client returns the SpectrumClient of a target.
+func (c *SVCCollector) Client(host Target) *SpectrumClient {
+	return c.clients[host.IpAddress]
+}
+
+func (c *SVCCollector) poll(host Target, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ExtraLabelsMutex.RLock()
+		start := time.Now()
+		// a collection must not overrun the next one
+		ctx, cancel := context.WithTimeout(c.ctx, interval)
+		metrics := CollectMetrics(func(ch chan<- prometheus.Metric) {
+			wg := &sync.WaitGroup{}
+			wg.Add(1)
+			c.collectForHost(ctx, host, ch, wg)
+		})
+		cancel()
+		ExtraLabelsMutex.RUnlock()
+		if c.ctx.Err() != nil {
+			// polling was stopped, discard the partial collection
+			return
+		}
+		c.set.snapshots.Set(host.IpAddress, Snapshot{Metrics: metrics, Time: start})
+		logger.Debugf("polled %d %s metrics of %s in %s", len(metrics), c.set.kind, host.IpAddress, time.Since(start))
+		select {
+		case <-ticker.C:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// Describe implements the Prometheus.Collector interface.
+func (c *SVCCollector) Describe(ch chan<- *prometheus.Desc) {
+	s := c.set
+	if c.selfMetrics {
+		ch <- s.scrapeDurationDesc
+		ch <- s.authTokenRenewSuccessDesc
+		ch <- s.authTokenRenewFailureDesc
+		ch <- s.authTokenRenewIntervalDesc
+		ch <- s.connectionsOpenedDesc
+		ch <- s.connectionsReusedDesc
+		ch <- s.upDesc
+		ch <- s.restRequestsDesc
+		ch <- s.restDurationDesc
+		ch <- s.restTokenRenewalsDesc
+		ch <- s.collectorSuccessDesc
+		ch <- s.collectorDurationDesc
+	}
+	if c.useSnapshots {
+		ch <- s.snapshotTimestampDesc
+		ch <- s.snapshotAgeDesc
+	}
+	for _, col := range c.collectors {
+		col.Describe(ch)
+	}
+}
+
+// Collect implements the Prometheus.Collector interface.
+func (c *SVCCollector) Collect(ch chan<- prometheus.Metric) {
+	wg := &sync.WaitGroup{}
+	wg.Add(len(c.targets))
+	for _, h := range c.targets {
+		if c.useSnapshots {
+			c.collectFromSnapshot(h, ch)
+			wg.Done()
+			continue
+		}
+		go c.collectForHost(c.ctx, h, ch, wg)
+	}
+	wg.Wait()
+}
+
+// collectFromSnapshot sends the metrics of the latest background snapshot of a host.
+func (c *SVCCollector) collectFromSnapshot(host Target, ch chan<- prometheus.Metric) {
+	snapshot, ok := c.set.snapshots.Get(host.IpAddress)
+	if !ok {
+		logger.Warnf("no snapshot of %s collected yet", host.IpAddress)
+		return
+	}
+	for _, m := range snapshot.Metrics {
+		ch <- m
+	}
+	labelvalues := []string{c.Client(host).Hostname}
+	if len(ExtraLabelValues) > 0 {
+		labelvalues = append(labelvalues, ExtraLabelValues...)
+	}
+	ch <- prometheus.MustNewConstMetric(c.set.snapshotTimestampDesc, prometheus.GaugeValue, float64(snapshot.Time.UnixNano())/1e9, labelvalues...)
+	ch <- prometheus.MustNewConstMetric(c.set.snapshotAgeDesc, prometheus.GaugeValue, time.Since(snapshot.Time).Seconds(), labelvalues...)
+}
+
+func (c *SVCCollector) collectForHost(ctx context.Context, host Target, ch chan<- prometheus.Metric, wg *sync.WaitGroup) {
+	defer wg.Done()
+	s := c.set
+	start := time.Now()
+	success := 0
+	var counter Counter
+	spectrumClient := c.Client(host)
+
+	counter, success = spectrumClient.RenewAuthToken(ctx, true)
+
+	// the hostname is known after the first successful login
+	labelvalues := []string{spectrumClient.Hostname}
+	if len(ExtraLabelValues) > 0 {
+		labelvalues = append(labelvalues, ExtraLabelValues...)
+	}
+	defer func() {
+		if !c.selfMetrics {
+			return
+		}
+		ch <- prometheus.MustNewConstMetric(s.upDesc, prometheus.GaugeValue, float64(success), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(s.scrapeDurationDesc, prometheus.GaugeValue, time.Since(start).Seconds(), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(s.authTokenRenewSuccessDesc, prometheus.CounterValue, float64(counter.AuthTokenRenewSuccessCount), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(s.authTokenRenewFailureDesc, prometheus.CounterValue, float64(counter.AuthTokenRenewFailureCount), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(s.authTokenRenewIntervalDesc, prometheus.GaugeValue, float64(counter.AuthTokenRenewIntervalSeconds), labelvalues...)
+		newConns, reusedConns := spectrumClient.Transport.ConnStats()
+		ch <- prometheus.MustNewConstMetric(s.connectionsOpenedDesc, prometheus.CounterValue, float64(newConns), labelvalues...)
+		ch <- prometheus.MustNewConstMetric(s.connectionsReusedDesc, prometheus.CounterValue, float64(reusedConns), labelvalues...)
+		restStats := spectrumClient.Transport.RestStats()
+		for _, call := range restStats.Calls() {
+			restLabelvalues := append([]string{labelvalues[0], call.Command, call.StatusClass}, labelvalues[1:]...)
+			ch <- prometheus.MustNewConstMetric(s.restRequestsDesc, prometheus.CounterValue, float64(call.Count), restLabelvalues...)
+			ch <- prometheus.MustNewConstHistogram(s.restDurationDesc, call.Count, call.Sum, call.Buckets, restLabelvalues...)
+		}
+		ch <- prometheus.MustNewConstMetric(s.restTokenRenewalsDesc, prometheus.CounterValue, float64(restStats.TokenRenewals()), labelvalues...)
+	}()
+
+	if success == 0 {
+		logger.Errorf("no valid auth token, skip executing %s collectors", s.kind)
+	}
+	canceled := false
+	for k, col := range c.collectors {
+		collectorStart := time.Now()
+		collectorSuccess := 0
+		if success == 1 && !canceled {
+			if ctx.Err() != nil {
+				logger.Errorf("skip the remaining collectors, the scrape of %s is canceled: %s", host.IpAddress, ctx.Err())
+				canceled = true
+			} else if err := s.runCollector(ctx, k, col, *spectrumClient, ch); err != nil && err.Error() != "EOF" {
+				logger.Errorln(k + ": " + err.Error())
+			} else {
+				collectorSuccess = 1
+			}
+		} else if col, ok := col.(UnauthenticatedCollector); ok && success == 0 {
+			col.CollectUnauthenticated(*spectrumClient, ch)
+		}
+		// the per-collector metrics are distinguished by the collector label, so they are also sent without selfMetrics
+		collectorLabelvalues := append([]string{labelvalues[0], k}, labelvalues[1:]...)
+		ch <- prometheus.MustNewConstMetric(s.collectorSuccessDesc, prometheus.GaugeValue, float64(collectorSuccess), collectorLabelvalues...)
+		ch <- prometheus.MustNewConstMetric(s.collectorDurationDesc, prometheus.GaugeValue, time.Since(collectorStart).Seconds(), collectorLabelvalues...)
+	}
+}
+
+// runCollector sends the metrics of a collector. Within the configured interval of the collector
+// the cached result of the last successful run is sent instead of calling the REST API again.
+// The REST calls of the collector are canceled after its configured timeout or when ctx is done.
+func (s *CollectorSet) runCollector(ctx context.Context, name string, col Collector, sClient SpectrumClient, ch chan<- prometheus.Metric) error {
+	config := s.Config(name)
+	key := sClient.IpAddress + "/" + name
+	if config.Interval > 0 {
+		if result, ok := s.collectorResults.Get(key); ok && time.Since(result.Time) < config.Interval {
+			logger.Debugf("%s: use the cached result of %s", name, sClient.IpAddress)
+			for _, m := range result.Metrics {
+				ch <- m
+			}
+			return nil
+		}
+	}
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	metrics, err := CollectMetricsWithContext(ctx, func(ctx context.Context, ch chan<- prometheus.Metric) error {
+		return col.Collect(ctx, sClient, ch)
+	})
+	if err == nil && config.Interval > 0 {
+		s.collectorResults.Set(key, Snapshot{Metrics: metrics, Time: start})
+	}
+	for _, m := range metrics {
+		ch <- m
+	}
+	return err
+}
@@ -15,22 +15,133 @@
 package utils
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	Targets         []Target        `yaml:"targets"`
-	ExtraLabels     []Label         `yaml:"extra_labels"`
-	TlsServerConfig TlsServerConfig `yaml:"tls_server_config"`
+	Targets         []Target                   `yaml:"targets"`
+	Credentials     map[string]Credential      `yaml:"credentials"`
+	Modules         map[string]Module          `yaml:"modules"`
+	ExtraLabels     []Label                    `yaml:"extra_labels"`
+	Polling         Polling                    `yaml:"polling"`
+	Collectors      map[string]CollectorConfig `yaml:"collectors"`
+	Alertmanager    Alertmanager               `yaml:"alertmanager"`
+	TlsServerConfig TlsServerConfig            `yaml:"tls_server_config"`
 	filename        string
 }
 
 type Target struct {
-	IpAddress string `yaml:"ipAddress"`
+	IpAddress     string    `yaml:"ipAddress"`
+	Userid        string    `yaml:"userid"`
+	Password      string    `yaml:"password"`
+	ManagementIps []NamedIp `yaml:"managementIps"` // probed by the ip collector, defaults to ipAddress as PSYS
+	ServiceIps    []NamedIp `yaml:"serviceIps"`    // probed by the ip collector
+	TargetTls     `yaml:",inline"`
+}
+
+// StateKey identifies the state of a target, e.g. its auth token and connections. Targets with the same IP
+// address but different credentials or certificate settings, e.g. probed by different modules, have different keys.
+func (t Target) StateKey() string {
+	settings, _ := json.Marshal(t)
+	sum := sha256.Sum256(settings)
+	return t.IpAddress + "/" + hex.EncodeToString(sum[:8])
+}
+
+// Credential is a named credentials profile used to scrape targets through the probe endpoint.
+type Credential struct {
 	Userid    string `yaml:"userid"`
 	Password  string `yaml:"password"`
+	TargetTls `yaml:",inline"`
+}
+
+// TargetTls configures how the certificate of a storage device is verified.
+type TargetTls struct {
+	VerifyCert      *bool  `yaml:"verifyCert"`      // verify the certificate chain and host name, defaults to true
+	CaCert          string `yaml:"caCert"`          // CA bundle in pem format used instead of the system roots
+	CertFingerprint string `yaml:"certFingerprint"` // SHA-256 fingerprint of the pinned certificate
+	ServerName      string `yaml:"serverName"`      // host name to verify the certificate against instead of the IP address
+}
+
+// Module is a named set of collectors plus the credentials profile used to probe a target.
+type Module struct {
+	Collectors  []string `yaml:"collectors"`
+	Credentials string   `yaml:"credentials"`
+	Targets     []string `yaml:"targets"` // CIDRs or host name patterns of the targets probed with the credentials, required with credentials
+}
+
+// Polling configures the background collection of the targets. It's disabled when interval is 0.
+type Polling struct {
+	Interval         time.Duration `yaml:"interval"`
+	SettingsInterval time.Duration `yaml:"settings_interval"` // defaults to interval
+}
+
+// Alertmanager configures the forwarding of the alerts of the event log to Alertmanager. It's disabled without url.
+type Alertmanager struct {
+	Url       string          `yaml:"url"`      // e.g. http://alertmanager:9093/api/v2/alerts
+	Interval  time.Duration   `yaml:"interval"` // defaults to 60s
+	BasicAuth BasicAuth       `yaml:"basic_auth"`
+	TlsConfig AlertmanagerTls `yaml:"tls_config"`
+}
+
+// BasicAuth are the credentials of HTTP basic authentication, it's not used without username.
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// AlertmanagerTls configures the TLS connection to Alertmanager for an https url.
+type AlertmanagerTls struct {
+	CaCert             string `yaml:"ca_cert"`              // CA bundle in pem format used instead of the system roots
+	ClientCert         string `yaml:"client_cert"`          // client certificate for mTLS, requires client_key
+	ClientKey          string `yaml:"client_key"`           // key of the client certificate
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // don't verify the certificate of Alertmanager
+}
+
+// CollectorConfig configures a single collector. The result of a collector is cached and reused
+// by the scrapes within interval; a collector taking longer than timeout is abandoned.
+type CollectorConfig struct {
+	Interval  time.Duration  `yaml:"interval"`
+	Timeout   time.Duration  `yaml:"timeout"`
+	Ports     *PortSelection `yaml:"ports"`      // only used by the port collectors, nil if not set
+	Icmp      bool           `yaml:"icmp"`       // only used by the ip collector
+	CleanRate bool           `yaml:"clean_rate"` // only used by the lsfcmap collector
+	Logins    bool           `yaml:"logins"`     // only used by the lshost collector
+}
+
+// PortSelection selects the ports collected by a port collector. A port is collected if it matches
+// every list which is set, all ports are collected by an empty selection.
+type PortSelection struct {
+	PortIds          []string `yaml:"port_ids"`
+	ClusterUse       []string `yaml:"cluster_use"`
+	AdapterLocations []string `yaml:"adapter_locations"`
+}
+
+// Matches reports whether a port with the given port id, cluster use and adapter location is selected.
+// A nil selection selects all ports.
+func (s *PortSelection) Matches(portId string, clusterUse string, adapterLocation string) bool {
+	if s == nil {
+		return true
+	}
+	return matchesAny(s.PortIds, portId) && matchesAny(s.ClusterUse, clusterUse) && matchesAny(s.AdapterLocations, adapterLocation)
+}
+
+func matchesAny(list []string, value string) bool {
+	return len(list) == 0 || slices.Contains(list, value)
 }
 
 type Label struct {
@@ -60,6 +171,62 @@ func (cfg *Config) _Init() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if cfg.Polling.Interval < 0 || cfg.Polling.SettingsInterval < 0 {
+		return nil, fmt.Errorf("polling intervals must not be negative")
+	}
+	if cfg.Polling.SettingsInterval == 0 {
+		cfg.Polling.SettingsInterval = cfg.Polling.Interval
+	}
+	if cfg.Alertmanager.Url != "" {
+		if u, err := url.Parse(cfg.Alertmanager.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("alertmanager.url must be an http or https URL")
+		}
+		if cfg.Alertmanager.Interval < 0 {
+			return nil, fmt.Errorf("alertmanager.interval must not be negative")
+		}
+		if cfg.Alertmanager.Interval == 0 {
+			cfg.Alertmanager.Interval = 60 * time.Second
+		}
+		if _, err := cfg.Alertmanager.TlsConfig.TlsClientConfig(); err != nil {
+			return nil, fmt.Errorf("alertmanager.tls_config: %s", err.Error())
+		}
+	}
+	for _, t := range cfg.Targets {
+		if _, err := t.TlsClientConfig(); err != nil {
+			return nil, fmt.Errorf("target '%s': %s", t.IpAddress, err.Error())
+		}
+		for _, ip := range append(slices.Clone(t.ManagementIps), t.ServiceIps...) {
+			if ip.Name == "" || ip.Address == "" {
+				return nil, fmt.Errorf("target '%s': the management and service IPs need a name and an address", t.IpAddress)
+			}
+		}
+	}
+	for name, credential := range cfg.Credentials {
+		if _, err := credential.TlsClientConfig(); err != nil {
+			return nil, fmt.Errorf("credentials '%s': %s", name, err.Error())
+		}
+	}
+	for name, collector := range cfg.Collectors {
+		if collector.Interval < 0 || collector.Timeout < 0 {
+			return nil, fmt.Errorf("interval and timeout of collector '%s' must not be negative", name)
+		}
+	}
+	for name, module := range cfg.Modules {
+		if len(module.Collectors) == 0 {
+			return nil, fmt.Errorf("module '%s' has no collectors", name)
+		}
+		if _, ok := cfg.Credentials[module.Credentials]; module.Credentials != "" && !ok {
+			return nil, fmt.Errorf("module '%s' refers to undefined credentials '%s'", name, module.Credentials)
+		}
+		if module.Credentials != "" && len(module.Targets) == 0 {
+			return nil, fmt.Errorf("module '%s' has credentials but no targets it may probe with them", name)
+		}
+		for _, pattern := range module.Targets {
+			if err := validTargetPattern(pattern); err != nil {
+				return nil, fmt.Errorf("module '%s': %s", name, err.Error())
+			}
+		}
+	}
 	return cfg, nil
 }
 func GetConfig(filename string) (*Config, error) {
@@ -67,3 +234,148 @@ func GetConfig(filename string) (*Config, error) {
 	cfg.SetFilename(filename)
 	return cfg._Init()
 }
+
+// ProbeTarget resolves the target and module of a probe request. A target listed under
+// targets is scraped with its own credentials, any other target with the credentials of the module
+// if it's allowed by the targets of the module.
+func (cfg *Config) ProbeTarget(ipAddress string, moduleName string) (Target, Module, error) {
+	module, ok := cfg.Modules[moduleName]
+	if !ok {
+		return Target{}, Module{}, fmt.Errorf("the module '%s' not defined in the configuration file", moduleName)
+	}
+	for _, t := range cfg.Targets {
+		if t.IpAddress == ipAddress {
+			return t, module, nil
+		}
+	}
+	if module.Credentials == "" {
+		return Target{}, Module{}, fmt.Errorf("the target '%s' not defined in the configuration file and the module '%s' has no credentials", ipAddress, moduleName)
+	}
+	// the credentials are sent to the target, so it must not be chosen freely by the requester
+	if !module.allowsTarget(ipAddress) {
+		return Target{}, Module{}, fmt.Errorf("the target '%s' is not allowed by the targets of the module '%s'", ipAddress, moduleName)
+	}
+	credential := cfg.Credentials[module.Credentials]
+	return Target{IpAddress: ipAddress, Userid: credential.Userid, Password: credential.Password, TargetTls: credential.TargetTls}, module, nil
+}
+
+// allowsTarget reports whether a target is an IP address within a CIDR or a host name matching
+// a pattern of the targets of the module.
+func (m Module) allowsTarget(target string) bool {
+	ip := net.ParseIP(target)
+	if ip == nil && !isHostName(target) {
+		return false
+	}
+	for _, pattern := range m.Targets {
+		if _, network, err := net.ParseCIDR(pattern); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+		} else if patternIp := net.ParseIP(pattern); patternIp != nil {
+			if patternIp.Equal(ip) {
+				return true
+			}
+		} else if ip == nil {
+			if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(target)); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validTargetPattern checks a CIDR, an IP address or a host name pattern like *.storage.example.com.
+func validTargetPattern(pattern string) error {
+	if strings.Contains(pattern, "/") {
+		if _, _, err := net.ParseCIDR(pattern); err != nil {
+			return fmt.Errorf("invalid CIDR '%s' in targets", pattern)
+		}
+		return nil
+	}
+	if net.ParseIP(pattern) != nil {
+		return nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil || !isHostName(strings.ReplaceAll(pattern, "*", "x")) {
+		return fmt.Errorf("invalid host name pattern '%s' in targets", pattern)
+	}
+	return nil
+}
+
+// isHostName reports whether s consists of the letters, digits, hyphens and dots of a host name only.
+func isHostName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// TlsClientConfig creates the TLS config to connect to a storage device. With a pinned certificate
+// fingerprint the certificate is trusted by its fingerprint instead of the CA.
+func (t TargetTls) TlsClientConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: t.VerifyCert != nil && !*t.VerifyCert, // #nosec G402 -- turned off explicitly by the user
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+	}
+	if t.CaCert != "" {
+		pem, err := os.ReadFile(t.CaCert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificate: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", t.CaCert)
+		}
+		config.RootCAs = pool
+	}
+	if t.CertFingerprint != "" {
+		fingerprint, err := hex.DecodeString(strings.ReplaceAll(t.CertFingerprint, ":", ""))
+		if err != nil || len(fingerprint) != sha256.Size {
+			return nil, fmt.Errorf("certFingerprint must be a SHA-256 fingerprint in hex format")
+		}
+		config.InsecureSkipVerify = true // #nosec G402 -- the certificate is verified by VerifyPeerCertificate
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no certificate presented")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			if !bytes.Equal(sum[:], fingerprint) {
+				return fmt.Errorf("certificate fingerprint %s doesn't match the pinned fingerprint", hex.EncodeToString(sum[:]))
+			}
+			return nil
+		}
+	}
+	return config, nil
+}
+
+// TlsClientConfig creates the TLS config to connect to Alertmanager.
+func (t AlertmanagerTls) TlsClientConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: t.InsecureSkipVerify, // #nosec G402 -- turned off explicitly by the user
+		MinVersion:         tls.VersionTLS12,
+	}
+	if t.CaCert != "" {
+		pem, err := os.ReadFile(t.CaCert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificate: %s", err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", t.CaCert)
+		}
+		config.RootCAs = pool
+	}
+	if t.ClientCert != "" || t.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client certificate: %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
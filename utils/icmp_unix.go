@@ -0,0 +1,95 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// icmpEcho sends an ICMP echo request to the address and returns the round-trip time of the reply. It uses an
+// unprivileged datagram ICMP socket, on Linux the group of the exporter has to be in net.ipv4.ping_group_range.
+func icmpEcho(ctx context.Context, address string, timeout time.Duration) (time.Duration, error) {
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, address)
+	if err != nil {
+		return 0, err
+	}
+	ip := ips[0].IP
+	family, proto, echoRequest, echoReply := syscall.AF_INET, syscall.IPPROTO_ICMP, byte(8), byte(0)
+	if ip.To4() == nil {
+		family, proto, echoRequest, echoReply = syscall.AF_INET6, syscall.IPPROTO_ICMPV6, byte(128), byte(129)
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM, proto)
+	if err != nil {
+		return 0, fmt.Errorf("error creating unprivileged ICMP socket: %s", err.Error())
+	}
+	f := os.NewFile(uintptr(fd), "icmp")
+	conn, err := net.FilePacketConn(f)
+	f.Close()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return 0, err
+	}
+	// the identifier is set to the local port of the socket by the kernel
+	seq := uint16(time.Now().UnixNano())
+	msg := []byte{echoRequest, 0, 0, 0, 0, 0, byte(seq >> 8), byte(seq), 's', 'p', 'e', 'c', 't', 'r', 'u', 'm'}
+	if family == syscall.AF_INET {
+		sum := icmpChecksum(msg)
+		msg[2], msg[3] = byte(sum>>8), byte(sum)
+	}
+	start := time.Now()
+	if _, err := conn.WriteTo(msg, &net.UDPAddr{IP: ip}); err != nil {
+		return 0, err
+	}
+	reply := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(reply)
+		if err != nil {
+			return 0, err
+		}
+		if n >= 8 && reply[0] == echoReply && uint16(reply[6])<<8|uint16(reply[7]) == seq {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// icmpChecksum returns the internet checksum of an ICMP message, the ICMPv6 checksum is set by the kernel.
+func icmpChecksum(msg []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(msg); i += 2 {
+		sum += uint32(msg[i])<<8 | uint32(msg[i+1])
+	}
+	if len(msg)%2 == 1 {
+		sum += uint32(msg[len(msg)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
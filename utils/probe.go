@@ -0,0 +1,66 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// ProbePorts are the TCP ports connected to by ProbeAddress in this order: the REST API and SSH.
+var ProbePorts = []string{"7443", "22"}
+
+// NamedIp is a management or service IP address of a storage device, probed by the ip collector.
+type NamedIp struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"` // IP address or host name
+}
+
+// ProbeResult is the result of probing an address. Method is the probe which reached the address,
+// e.g. tcp:7443 or icmp, or none if the address is unreachable.
+type ProbeResult struct {
+	Reachable bool
+	Rtt       time.Duration
+	Method    string
+}
+
+// ProbeAddress probes an address with a TCP connect to each of the ProbePorts and, if icmp is set and no
+// port could be connected, with an ICMP echo request. Each probe is abandoned after timeout.
+func ProbeAddress(ctx context.Context, address string, icmp bool, timeout time.Duration) (ProbeResult, error) {
+	var lastErr error
+	for _, port := range ProbePorts {
+		start := time.Now()
+		dialer := net.Dialer{Timeout: timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, port))
+		if err == nil {
+			rtt := time.Since(start)
+			conn.Close()
+			return ProbeResult{Reachable: true, Rtt: rtt, Method: "tcp:" + port}, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			return ProbeResult{Method: "none"}, ctx.Err()
+		}
+	}
+	if icmp {
+		rtt, err := icmpEcho(ctx, address, timeout)
+		if err == nil {
+			return ProbeResult{Reachable: true, Rtt: rtt, Method: "icmp"}, nil
+		}
+		lastErr = err
+	}
+	return ProbeResult{Method: "none"}, lastErr
+}
@@ -0,0 +1,120 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RestDurationBuckets are the upper bounds of the REST call latency histogram in seconds.
+var RestDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// RestCallStats are the cumulative statistics of the REST calls of one command with one status class.
+type RestCallStats struct {
+	Command     string
+	StatusClass string // 2xx, 4xx, 5xx, ... or error if no response was received
+	Count       uint64
+	Sum         float64            // total duration in seconds
+	Buckets     map[float64]uint64 // cumulative count of calls per upper bound of RestDurationBuckets
+}
+
+type restCallKey struct {
+	command     string
+	statusClass string
+}
+
+// RestStats records the REST calls of a target by command and status class.
+type RestStats struct {
+	mutex         sync.Mutex
+	calls         map[restCallKey]*RestCallStats
+	tokenRenewals uint64
+}
+
+func NewRestStats() *RestStats {
+	return &RestStats{calls: make(map[restCallKey]*RestCallStats)}
+}
+
+// restCommand returns the command of a REST call without its object, e.g. lsdrive for lsdrive/3.
+func restCommand(restCmd string) string {
+	return strings.SplitN(restCmd, "/", 2)[0]
+}
+
+// statusClass returns the class of an HTTP status code, e.g. 4xx for 403.
+func statusClass(statusCode int) string {
+	return fmt.Sprintf("%dxx", statusCode/100)
+}
+
+// Observe records a REST call which took d.
+func (r *RestStats) Observe(restCmd string, statusClass string, d time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	key := restCallKey{command: restCommand(restCmd), statusClass: statusClass}
+	stats, ok := r.calls[key]
+	if !ok {
+		stats = &RestCallStats{Command: key.command, StatusClass: statusClass, Buckets: make(map[float64]uint64)}
+		for _, b := range RestDurationBuckets {
+			stats.Buckets[b] = 0
+		}
+		r.calls[key] = stats
+	}
+	seconds := d.Seconds()
+	stats.Count++
+	stats.Sum += seconds
+	for _, b := range RestDurationBuckets {
+		if seconds <= b {
+			stats.Buckets[b]++
+		}
+	}
+}
+
+// ObserveTokenRenewal records an auth token renewal triggered by a rejected REST call.
+func (r *RestStats) ObserveTokenRenewal() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.tokenRenewals++
+}
+
+// Calls returns a copy of the statistics of all recorded commands and status classes, sorted by command.
+func (r *RestStats) Calls() []RestCallStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	calls := make([]RestCallStats, 0, len(r.calls))
+	for _, stats := range r.calls {
+		c := *stats
+		c.Buckets = make(map[float64]uint64, len(stats.Buckets))
+		for b, n := range stats.Buckets {
+			c.Buckets[b] = n
+		}
+		calls = append(calls, c)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		if calls[i].Command != calls[j].Command {
+			return calls[i].Command < calls[j].Command
+		}
+		return calls[i].StatusClass < calls[j].StatusClass
+	})
+	return calls
+}
+
+// TokenRenewals returns the number of auth token renewals triggered by rejected REST calls.
+func (r *RestStats) TokenRenewals() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.tokenRenewals
+}
@@ -0,0 +1,107 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Snapshot is the result of one collection of a target.
+type Snapshot struct {
+	Metrics []prometheus.Metric
+	Time    time.Time // when the collection started
+}
+
+// SnapshotCache keeps the latest Snapshot of each target, keyed by the target's IP address.
+type SnapshotCache struct {
+	mutex     sync.RWMutex
+	snapshots map[string]Snapshot
+}
+
+func NewSnapshotCache() *SnapshotCache {
+	return &SnapshotCache{snapshots: make(map[string]Snapshot)}
+}
+
+// Get returns the latest Snapshot of a target.
+func (c *SnapshotCache) Get(key string) (Snapshot, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	s, ok := c.snapshots[key]
+	return s, ok
+}
+
+// Set replaces the Snapshot of a target.
+func (c *SnapshotCache) Set(key string, s Snapshot) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.snapshots[key] = s
+}
+
+// Clear removes the Snapshots of all targets.
+func (c *SnapshotCache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.snapshots = make(map[string]Snapshot)
+}
+
+// CollectMetrics runs collect and returns all metrics it sent to the channel.
+func CollectMetrics(collect func(ch chan<- prometheus.Metric)) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	var metrics []prometheus.Metric
+	go func() {
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+	collect(ch)
+	close(ch)
+	<-done
+	return metrics
+}
+
+// CollectMetricsWithContext runs collect and returns all metrics it sent to the channel and its error.
+// If ctx is done before collect returns, its metrics are discarded and the error of ctx is returned.
+func CollectMetricsWithContext(ctx context.Context, collect func(ctx context.Context, ch chan<- prometheus.Metric) error) ([]prometheus.Metric, error) {
+	ch := make(chan prometheus.Metric)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- collect(ctx, ch)
+		close(ch)
+	}()
+
+	var metrics []prometheus.Metric
+	for {
+		select {
+		case m, ok := <-ch:
+			if !ok {
+				return metrics, <-errCh
+			}
+			metrics = append(metrics, m)
+		case <-ctx.Done():
+			// drain the abandoned collect so that it can finish
+			go func() {
+				for range ch {
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
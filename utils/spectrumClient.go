@@ -15,13 +15,17 @@
 package utils
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
+	_ "time/tzdata" // the time zones of the storage devices, also without the zoneinfo of the system
 
 	"github.com/prometheus/common/log"
 	"github.com/tidwall/gjson"
@@ -30,6 +34,10 @@ import (
 var logger = log.With("component", "spectrum_exporter")
 var ExtraLabelNames, ExtraLabelValues []string
 
+// ExtraLabelsMutex guards ExtraLabelNames, ExtraLabelValues and the metric descriptors built from them.
+// Scrapes hold it for reading, a config reload which changes the extra labels holds it for writing.
+var ExtraLabelsMutex sync.RWMutex
+
 type SpectrumClient struct {
 	UserName       string
 	Password       string
@@ -39,12 +47,17 @@ type SpectrumClient struct {
 	VerifyCert     bool
 	AuthTokenCache *AuthToken
 	AuthTokenMutex *sync.Mutex
-	ColCounter     *Counter //shared cross all SpectrumClients of a target
+	ColCounter     *Counter   //shared cross all SpectrumClients of a target
+	Transport      *Transport //shared cross all SpectrumClients of a target
+	ManagementIps  []NamedIp
+	ServiceIps     []NamedIp
+	TimeZone       *time.Location // the time zone of the storage device, known after the first successful login
 }
 
 type AuthToken struct {
 	Token      string
 	Hostname   string
+	TimeZone   *time.Location
 	UpdateTime time.Time
 }
 
@@ -54,13 +67,21 @@ type Counter struct {
 	AuthTokenRenewFailureCount    int
 }
 
-func (s *SpectrumClient) RenewAuthToken(needVerify bool) (Counter, int) {
+// RenewAuthToken returns the counters of the target and 1 if a valid auth token is cached or could be
+// renewed, otherwise 0. The REST calls are canceled when ctx is done.
+func (s *SpectrumClient) RenewAuthToken(ctx context.Context, needVerify bool) (Counter, int) {
 	defer s.AuthTokenMutex.Unlock()
 	s.AuthTokenMutex.Lock()
 
 	// A single session lasts a maximum of two active hours or thirty inactive minutes, whichever occurs first.
 	retVal := 0 // 0: failed, 1: success
 	if s.AuthTokenCache.Token != "" {
+		if s.Hostname == "" {
+			s.Hostname = s.AuthTokenCache.Hostname
+		}
+		if s.TimeZone == nil {
+			s.TimeZone = s.AuthTokenCache.TimeZone
+		}
 		if time.Since(s.AuthTokenCache.UpdateTime).Seconds() < 28 {
 			logger.Debugln("return existing token updated in 28s")
 			return *s.ColCounter, 1
@@ -70,7 +91,7 @@ func (s *SpectrumClient) RenewAuthToken(needVerify bool) (Counter, int) {
 			updatePassedMins := time.Since(s.AuthTokenCache.UpdateTime).Minutes()
 			if updatePassedMins < 118 {
 				/* 			logger.Debugln("Verify existing token")
-				   			_, err := s.CallSpectrumAPI("lssystem", false)
+				   			_, err := s.CallSpectrumAPI(ctx, "lssystem", false)
 				   			if err == nil {
 				   				logger.Debugln("Existing token verified successfully")
 				   				retVal = 1
@@ -82,9 +103,6 @@ func (s *SpectrumClient) RenewAuthToken(needVerify bool) (Counter, int) {
 				logger.Debugf("it's been %.0f minutes since the token update", updatePassedMins)
 			}
 			if retVal == 1 {
-				if s.Hostname == "" {
-					s.Hostname = s.AuthTokenCache.Hostname
-				}
 				logger.Debugf("return cached token updated in %.0f minutes", updatePassedMins)
 				return *s.ColCounter, retVal
 			}
@@ -94,8 +112,12 @@ func (s *SpectrumClient) RenewAuthToken(needVerify bool) (Counter, int) {
 	lc := 0
 	for lc = 0; lc < 3; lc++ {
 		logger.Debugln("getting authToken for ", s.IpAddress)
-		authtoken, err := s.retrieveAuthToken()
+		authtoken, err := s.retrieveAuthToken(ctx)
 		if err != nil {
+			if ctx.Err() != nil {
+				logger.Warnf("canceled requesting auth token for %s: %v", s.IpAddress, ctx.Err())
+				return *s.ColCounter, retVal
+			}
 			logger.Errorf("failed to request auth token for %s, the error is: %v", s.IpAddress, err)
 			s.ColCounter.AuthTokenRenewFailureCount++
 			return *s.ColCounter, retVal
@@ -113,10 +135,13 @@ func (s *SpectrumClient) RenewAuthToken(needVerify bool) (Counter, int) {
 			logger.Debugln("verify new auth token for ", s.IpAddress)
 			i := 0
 			for i < 2 {
-				systemMetrics, err := s.CallSpectrumAPI("lssystem", false)
+				systemMetrics, err := s.CallSpectrumAPI(ctx, "lssystem", false)
 				if err != nil {
 					if i == 0 {
-						time.Sleep(2 * time.Second)
+						select {
+						case <-time.After(2 * time.Second):
+						case <-ctx.Done():
+						}
 					}
 					i++
 				} else {
@@ -125,9 +150,15 @@ func (s *SpectrumClient) RenewAuthToken(needVerify bool) (Counter, int) {
 						s.Hostname = gjson.Get(systemMetrics, "name").String()
 						s.AuthTokenCache.Hostname = s.Hostname
 					}
+					s.TimeZone = systemTimeZone(s.IpAddress, gjson.Get(systemMetrics, "time_zone").String())
+					s.AuthTokenCache.TimeZone = s.TimeZone
 					break
 				}
 			}
+			if ctx.Err() != nil { // the token wasn't rejected, keep it for the next scrape
+				logger.Warnf("canceled verifying auth token for %s: %v", s.IpAddress, ctx.Err())
+				return *s.ColCounter, retVal
+			}
 			if i > 1 { //auth token verification failed
 				s.AuthTokenCache.Token = ""
 				logger.Infof("token verification failed for %s, re-requesting authtoken....", s.IpAddress)
@@ -152,28 +183,39 @@ func (s *SpectrumClient) RenewAuthToken(needVerify bool) (Counter, int) {
 	return *s.ColCounter, retVal
 }
 
-func (s *SpectrumClient) retrieveAuthToken() (authToken string, err error) {
-	requestURL := "https://" + s.IpAddress + ":7443/rest/auth"
-	httpClient := &http.Client{Transport: &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		TLSClientConfig:       &tls.Config{InsecureSkipVerify: false, MinVersion: tls.VersionTLS12},
-	},
-		Timeout: 45 * time.Second,
+// ParseTime parses a time without time zone reported by the storage device, e.g. 240301081512 with the layout
+// 060102150405, in the time zone of the storage device. The local time zone of the exporter is used until the
+// time zone of the storage device is known.
+func (s SpectrumClient) ParseTime(layout string, value string) (time.Time, error) {
+	location := s.TimeZone
+	if location == nil {
+		location = time.Local
+	}
+	return time.ParseInLocation(layout, value, location)
+}
+
+// systemTimeZone returns the location of the time_zone of lssystem, e.g. "522 UTC" or "520 US/Pacific".
+func systemTimeZone(ipAddress string, timeZone string) *time.Location {
+	fields := strings.Fields(timeZone)
+	if len(fields) == 0 {
+		logger.Warnf("no time zone reported by %s, use the local time zone", ipAddress)
+		return nil
 	}
-	req, _ := http.NewRequest("POST", requestURL, nil)
+	location, err := time.LoadLocation(fields[len(fields)-1])
+	if err != nil {
+		logger.Warnf("unknown time zone %q of %s, use the local time zone: %s", timeZone, ipAddress, err.Error())
+		return nil
+	}
+	return location
+}
+
+func (s *SpectrumClient) retrieveAuthToken(ctx context.Context) (authToken string, err error) {
+	requestURL := "https://" + s.IpAddress + ":7443/rest/auth"
+	req, _ := http.NewRequestWithContext(ctx, "POST", requestURL, nil)
 	req.Header.Add("X-Auth-Username", s.UserName)
 	req.Header.Add("X-Auth-Password", s.Password)
 	// req.SetBasicAuth(s.UserName, s.Password)
-	resp, err := httpClient.Do(req)
+	resp, err := s.Transport.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("error connecting to : %s. the error is: %s", requestURL, err.Error())
 	}
@@ -192,63 +234,96 @@ func (s *SpectrumClient) retrieveAuthToken() (authToken string, err error) {
 	return authToken, nil
 }
 
-func (s *SpectrumClient) CallSpectrumAPI(restCmd string, autoRenewToken bool) (body string, err error) {
+// CallSpectrumAPI runs a REST command and returns the response body. The call is canceled when ctx is done.
+func (s *SpectrumClient) CallSpectrumAPI(ctx context.Context, restCmd string, autoRenewToken bool) (body string, err error) {
+	return s.CallSpectrumAPIWithParams(ctx, restCmd, nil, autoRenewToken)
+}
+
+// CallSpectrumAPIWithParams runs a REST command with the parameters of the command, e.g. {"prefix": "/dumps"}
+// for "lsdumps -prefix /dumps", and returns the response body. The call is canceled when ctx is done.
+func (s *SpectrumClient) CallSpectrumAPIWithParams(ctx context.Context, restCmd string, params map[string]string, autoRenewToken bool) (body string, err error) {
 	requestURL := "https://" + s.IpAddress + ":7443/rest/" + restCmd
-	httpClient := &http.Client{Transport: &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		TLSClientConfig:       &tls.Config{InsecureSkipVerify: false, MinVersion: tls.VersionTLS12},
-	},
-		Timeout: 45 * time.Second}
+	var reqBody []byte
+	if len(params) > 0 {
+		reqBody, err = json.Marshal(params)
+		if err != nil {
+			return "", fmt.Errorf("invalid parameters of %s: %s", restCmd, err.Error())
+		}
+	}
 	// New POST request
-	req, _ := http.NewRequest("POST", requestURL, nil)
+	req, _ := http.NewRequestWithContext(ctx, "POST", requestURL, bytes.NewReader(reqBody))
 	// header parameters
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("X-Auth-Token", s.AuthTokenCache.Token)
 	logger.Debugf("Request %s using token: %s", requestURL, s.AuthTokenCache.Token)
 	//var resp *http.Response
-	resp, err := httpClient.Do(req)
+	restStats := s.Transport.RestStats()
+	start := time.Now()
+	resp, err := s.Transport.Do(req)
 	if err != nil {
+		restStats.Observe(restCmd, "error", time.Since(start))
 		logger.Debugf("error connecting to Spectrum: %s", err.Error())
 		return "", fmt.Errorf("error connecting to : %s. the error is: %s", requestURL, err.Error())
 	}
 	if autoRenewToken && (resp.StatusCode == 401 || resp.StatusCode == 403) {
+		// drain the rejected response so that its connection can be reused
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		restStats.Observe(restCmd, statusClass(resp.StatusCode), time.Since(start))
+		restStats.ObserveTokenRenewal()
 		logger.Infoln("token is invalid, start to auto renew auth token")
-		_, success := s.RenewAuthToken(false)
+		_, success := s.RenewAuthToken(ctx, false)
 		if success == 0 {
 			return "", fmt.Errorf("failed to auto renew auth token for %s", s.IpAddress)
 		}
 		logger.Infoln("auto renewed token and retry rest cmd")
-		req, _ := http.NewRequest("POST", requestURL, nil)
+		req, _ := http.NewRequestWithContext(ctx, "POST", requestURL, bytes.NewReader(reqBody))
 		req.Header.Add("Accept", "application/json")
 		req.Header.Add("Content-Type", "application/json")
 		req.Header.Add("X-Auth-Token", s.AuthTokenCache.Token)
 		logger.Debugf("Re-request %s using token: %s", requestURL, s.AuthTokenCache.Token)
-		resp, err = httpClient.Do(req)
+		start = time.Now()
+		resp, err = s.Transport.Do(req)
 		if err != nil {
+			restStats.Observe(restCmd, "error", time.Since(start))
 			logger.Debugf("error connecting to Spectrum: %s", err.Error())
 			return "", fmt.Errorf("error connecting to : %s. the error is: %s", requestURL, err.Error())
 		}
 	}
 	defer resp.Body.Close()
 	respbody, err := io.ReadAll(resp.Body)
+	restStats.Observe(restCmd, statusClass(resp.StatusCode), time.Since(start))
 	body = string(respbody)
 	if resp.StatusCode != 200 {
-		logger.Debugf("http status code is %v when accessing URL: %s. Body text is: %s", resp.StatusCode, requestURL, body)
-		return "", fmt.Errorf("http status code is %v when accessing URL: %s. Body text is: %s", resp.StatusCode, requestURL, body)
+		err := &StatusError{URL: requestURL, StatusCode: resp.StatusCode, Body: body}
+		logger.Debugln(err.Error())
+		return "", err
 	}
 	return body, nil
 }
 
+// StatusError is the error of a REST command which the storage device answered with a status code other than 200.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http status code is %v when accessing URL: %s. Body text is: %s", e.StatusCode, e.URL, e.Body)
+}
+
+// IsUnknownCommand reports whether the storage device rejected a REST command because its code level doesn't
+// support the command, with status code 404 or the CLI error CMMVC7205E (the command is not supported).
+func IsUnknownCommand(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.StatusCode == 404 || strings.Contains(statusErr.Body, "CMMVC7205E")
+}
+
 func SpectrumLogger() *log.Logger {
 	return &logger
 }
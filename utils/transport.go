@@ -0,0 +1,124 @@
+// Copyright 2021-2024 IBM Corp. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transport is the long-lived HTTP transport of a target, shared cross all SpectrumClients of the
+// target. It keeps connections alive between REST calls and counts how often they are reused.
+type Transport struct {
+	client         *http.Client
+	err            error // error of the target's TLS settings, returned by every request
+	newConns       uint64
+	reusedConns    uint64
+	restStats      *RestStats
+	peerCerts      []*x509.Certificate // certificate chain presented by the target in the last TLS handshake
+	peerCertsMutex sync.Mutex
+}
+
+// NewTransport creates the transport of a target with the TLS settings of the target.
+func NewTransport(t Target) *Transport {
+	tlsConfig, err := t.TlsClientConfig()
+	if err != nil {
+		return &Transport{err: fmt.Errorf("invalid TLS settings of %s: %s", t.IpAddress, err.Error()), restStats: NewRestStats()}
+	}
+	return &Transport{
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				ForceAttemptHTTP2:     true, // the custom TLS config disables HTTP/2 otherwise
+				MaxIdleConns:          8,
+				MaxIdleConnsPerHost:   8,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+				TLSClientConfig:       tlsConfig,
+			},
+			Timeout: 45 * time.Second,
+		},
+		restStats: NewRestStats(),
+	}
+}
+
+// Do sends a request and records whether a new or an idle connection was used.
+func (t *Transport) Do(req *http.Request) (*http.Response, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddUint64(&t.reusedConns, 1)
+			} else {
+				atomic.AddUint64(&t.newConns, 1)
+			}
+		},
+	}
+	resp, err := t.client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	var certErr *tls.CertificateVerificationError
+	if err == nil && resp.TLS != nil {
+		t.setPeerCertificates(resp.TLS.PeerCertificates)
+	} else if errors.As(err, &certErr) {
+		// keep the chain of an expired or untrusted certificate, it's what breaks the REST calls
+		t.setPeerCertificates(certErr.UnverifiedCertificates)
+	}
+	return resp, err
+}
+
+func (t *Transport) setPeerCertificates(certs []*x509.Certificate) {
+	t.peerCertsMutex.Lock()
+	defer t.peerCertsMutex.Unlock()
+	t.peerCerts = certs
+}
+
+// PeerCertificates returns the certificate chain presented by the target in the last TLS handshake of a
+// REST call, the leaf certificate first. It's nil before the first REST call.
+func (t *Transport) PeerCertificates() []*x509.Certificate {
+	t.peerCertsMutex.Lock()
+	defer t.peerCertsMutex.Unlock()
+	return t.peerCerts
+}
+
+// ConnStats returns the number of opened and reused connections.
+func (t *Transport) ConnStats() (newConns uint64, reusedConns uint64) {
+	return atomic.LoadUint64(&t.newConns), atomic.LoadUint64(&t.reusedConns)
+}
+
+// RestStats returns the statistics of the REST calls sent through the transport.
+func (t *Transport) RestStats() *RestStats {
+	return t.restStats
+}
+
+// CloseIdleConnections closes the idle connections of the transport.
+func (t *Transport) CloseIdleConnections() {
+	if t.client != nil {
+		t.client.CloseIdleConnections()
+	}
+}